@@ -3,8 +3,10 @@ package behavior_test
 // Simply run using `go test ./... -v`
 
 import (
+	"bufio"
 	"bytes"
 	. "github.com/smartystreets/goconvey/convey"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -14,7 +16,7 @@ import (
 )
 
 func runCommands(cmds []string, dbfile string) []string {
-	cmd := exec.Command("go", "run", "../main.go", dbfile)
+	cmd := exec.Command("go", "run", "../main.go", "-interactive", dbfile)
 
 	var outb, errb bytes.Buffer
 	cmd.Stdout = &outb
@@ -50,14 +52,90 @@ func runCommands(cmds []string, dbfile string) []string {
 	return strings.Split(out, "\n")
 }
 
+// runArgs runs the database with args, feeding it stdin,
+// and returns its output along with its exit code
+func runArgs(args []string, stdin string) ([]string, int) {
+	cmd := exec.Command("go", append([]string{"run", "../main.go"}, args...)...)
+	cmd.Stdin = strings.NewReader(stdin)
+	var outb bytes.Buffer
+	cmd.Stdout = &outb
+	err := cmd.Run()
+	code := 0
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		log.Fatal(err)
+	}
+	return strings.Split(outb.String(), "\n"), code
+}
+
+// shell is a database process that is fed
+// commands while it is running
+type shell struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stdout *bufio.Reader
+}
+
+func startShell(dbfile string) *shell {
+	cmd := exec.Command("go", "run", "../main.go", "-interactive", dbfile)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		log.Fatal(err)
+	}
+	return &shell{cmd, stdin, bufio.NewReader(stdout)}
+}
+
+// run sends cmds to the shell and returns the
+// next line of output for each of them
+func (s *shell) run(cmds ...string) []string {
+	out := []string{}
+	for _, c := range cmds {
+		if _, err := s.stdin.Write([]byte(c + "\n")); err != nil {
+			log.Fatal(err)
+		}
+		line, err := s.stdout.ReadString('\n')
+		if err != nil {
+			log.Fatal(err)
+		}
+		out = append(out, strings.TrimSuffix(line, "\n"))
+	}
+	return out
+}
+
+// exit sends cmds, the last of which must end the
+// shell, and returns the rest of the output
+func (s *shell) exit(cmds ...string) []string {
+	for _, c := range cmds {
+		if _, err := s.stdin.Write([]byte(c + "\n")); err != nil {
+			log.Fatal(err)
+		}
+	}
+	rest, err := io.ReadAll(s.stdout)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := s.cmd.Wait(); err != nil {
+		log.Fatal(err)
+	}
+	return strings.Split(string(rest), "\n")
+}
+
 func TestSpec(t *testing.T) {
 	dbFile := "tmp.db"
 	Convey("database behaves correctly", t, func() {
 
 		Convey("on inserting a row returns it", func() {
 			cmds := []string{
-				"insert 1 user1 person1@example.com",
-				"select",
+				"insert 1 user1 person1@example.com;",
+				"select;",
 				".exit"}
 			output := runCommands(cmds, dbFile)
 			defer func() {
@@ -82,7 +160,7 @@ func TestSpec(t *testing.T) {
 			for i := 1; i <= 1301; i++ {
 				cmds = append(
 					cmds,
-					"insert "+strconv.Itoa(i)+"someuser some@email.com",
+					"insert "+strconv.Itoa(i)+"someuser some@email.com;",
 				)
 			}
 			cmds = append(cmds, ".exit")
@@ -99,8 +177,8 @@ func TestSpec(t *testing.T) {
 			longEmail := strings.Repeat("a", 256)
 
 			cmds := []string{
-				"insert 1 " + longUsername + " " + longEmail,
-				"select",
+				"insert 1 " + longUsername + " " + longEmail + ";",
+				"select;",
 				".exit",
 			}
 			dbFile := "tmp.db"
@@ -117,8 +195,8 @@ func TestSpec(t *testing.T) {
 			longEmail := strings.Repeat("a", 257)
 
 			cmds := []string{
-				"insert 1 " + longUsername + " " + longEmail,
-				"select",
+				"insert 1 " + longUsername + " " + longEmail + ";",
+				"select;",
 				".exit",
 			}
 			dbFile := "tmp.db"
@@ -131,8 +209,8 @@ func TestSpec(t *testing.T) {
 		})
 		Convey("prints an error message if id is negative", func() {
 			cmds := []string{
-				"insert -1 user name@domain.com",
-				"select",
+				"insert -1 user name@domain.com;",
+				"select;",
 				".exit",
 			}
 			output := runCommands(cmds, dbFile)
@@ -143,11 +221,907 @@ func TestSpec(t *testing.T) {
 			So(output[len(output)-3], ShouldEqual, "db >ID must be positive.")
 		})
 
+		Convey("accepts a statement timeout", func() {
+			cmds := []string{
+				".timeout abc",
+				".timeout 1000",
+				"insert 1 user1 person1@example.com;",
+				"select;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Invalid arguments to '.timeout abc'",
+					"db >db >Executed.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("rolls back and commits transactions", func() {
+			cmds := []string{
+				"commit;",
+				"begin;",
+				"insert 1 user1 person1@example.com;",
+				"begin;",
+				"select;",
+				"rollback;",
+				"select;",
+				"begin transaction;",
+				"insert 2 user2 person2@example.com;",
+				"commit;",
+				"select;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Error: No transaction is active.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Error: Cannot start a transaction within a transaction.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >(2, user2, person2@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("rolls back to savepoints", func() {
+			cmds := []string{
+				"savepoint a;",
+				"begin;",
+				"insert 1 user1 person1@example.com;",
+				"savepoint a;",
+				"insert 2 user2 person2@example.com;",
+				"rollback to savepoint a;",
+				"release b;",
+				"release a;",
+				"commit;",
+				"select;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Error: No transaction is active.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Error: No such savepoint.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("locks out a second writer process", func() {
+			defer func() {
+				os.Remove(dbFile)
+			}()
+			first := startShell(dbFile)
+			So(
+				first.run(
+					"begin;",
+					"insert 1 user1 person1@example.com;",
+				),
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+				},
+			)
+
+			output := runCommands(
+				[]string{
+					"insert 2 user2 person2@example.com;",
+					"select;",
+					".exit",
+				},
+				dbFile,
+			)
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Error: database is locked.",
+					"db >Executed.",
+					"db >",
+				},
+			)
+
+			So(
+				first.exit("commit;", ".exit"),
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >",
+				},
+			)
+			output = runCommands(
+				[]string{
+					".busy_timeout 1000",
+					"insert 2 user2 person2@example.com;",
+					"select;",
+					".exit",
+				},
+				dbFile,
+			)
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >db >Executed.",
+					"db >(1, user1, person1@example.com)",
+					"(2, user2, person2@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("prints an error message if id is already taken", func() {
+			cmds := []string{
+				"insert 1 user1 person1@example.com;",
+				"insert 1 user2 person2@example.com;",
+				"select;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Error: Duplicate key.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("looks rows up through an index", func() {
+			cmds := []string{
+				"insert 1 user1 person1@example.com;",
+				"insert 2 user2 person2@example.com;",
+				"create unique index on users(email);",
+				"insert 3 user3 person2@example.com;",
+				"select * from users where email = 'person2@example.com';",
+				"select * from users where id = 1;",
+				"create index on users(email);",
+				"drop index users_email_idx;",
+				"drop index users_email_idx;",
+				"select * from users where nickname = 'x';",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >Error: Duplicate key.",
+					"db >(2, user2, person2@example.com)",
+					"Executed.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >Error: Index already exists.",
+					"db >Executed.",
+					"db >Error: No such index.",
+					"db >Error: No such column.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("selects ranges of ids", func() {
+			cmds := []string{
+				"insert 3 user3 person3@example.com;",
+				"insert 1 user1 person1@example.com;",
+				"insert 2 user2 person2@example.com;",
+				"select * from users where id between 2 and 3;",
+				"select * from users where id = 1;",
+				"select * from users where id between 'a' and 'b';",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >(2, user2, person2@example.com)",
+					"(3, user3, person3@example.com)",
+					"Executed.",
+					"db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >Error: Value does not match the type of the column.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("explains query plans", func() {
+			cmds := []string{
+				"explain select;",
+				"explain select * from users where email = 'a@example.com';",
+				"create index on users(email);",
+				"explain select * from users where email = 'a@example.com';",
+				"explain select * from users where id between 1 and 5;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >QUERY PLAN",
+					"`--SCAN users",
+					"Executed.",
+					"db >QUERY PLAN",
+					"`--FILTER email = 'a@example.com'",
+					"   `--SCAN users",
+					"Executed.",
+					"db >Executed.",
+					"db >QUERY PLAN",
+					"`--SEARCH users USING INDEX users_email_idx (email = 'a@example.com')",
+					"Executed.",
+					"db >QUERY PLAN",
+					"`--SEARCH users USING INDEX users_pkey (id BETWEEN 1 AND 5)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("picks the access path from statistics", func() {
+			cmds := []string{}
+			for i := 1; i <= 40; i++ {
+				cmds = append(cmds, "insert "+strconv.Itoa(i)+" user"+strconv.Itoa(i)+" person"+strconv.Itoa(i%2)+"@example.com;")
+			}
+			cmds = append(cmds,
+				"create index on users(email);",
+				"explain select * from users where email = 'person1@example.com';",
+				"analyze;",
+				"explain select * from users where email = 'person1@example.com';",
+				"explain select * from users where id = 5;",
+				".exit",
+			)
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output[41:],
+				ShouldResemble,
+				[]string{
+					"db >QUERY PLAN",
+					"`--SEARCH users USING INDEX users_email_idx (email = 'person1@example.com')",
+					"Executed.",
+					"db >Executed.",
+					"db >QUERY PLAN",
+					"`--FILTER email = 'person1@example.com'",
+					"   `--SCAN users",
+					"Executed.",
+					"db >QUERY PLAN",
+					"`--SEARCH users USING INDEX users_pkey (id = 5)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("sorts, limits, projects and aggregates", func() {
+			cmds := []string{
+				"insert 2 user2 person2@example.com;",
+				"insert 3 user3 person3@example.com;",
+				"insert 1 user1 person1@example.com;",
+				"select id, username from users order by id;",
+				"select email from users order by email desc limit 2;",
+				"select count(*), min(id), max(username) from users;",
+				"select max(id) from users where id between 10 and 20;",
+				"explain select id from users order by id limit 1;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >Executed.",
+					"db >(1, user1)",
+					"(2, user2)",
+					"(3, user3)",
+					"Executed.",
+					"db >(person3@example.com)",
+					"(person2@example.com)",
+					"Executed.",
+					"db >(3, 1, user3)",
+					"Executed.",
+					"db >(NULL)",
+					"Executed.",
+					"db >QUERY PLAN",
+					"`--PROJECT id",
+					"   `--LIMIT 1",
+					"      `--SORT BY id",
+					"         `--SCAN users",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("renders results in the chosen mode", func() {
+			cmds := []string{
+				"insert 1 user1 person1@example.com;",
+				"insert 2 user,2 person2@example.com;",
+				".mode table",
+				"select id, username from users;",
+				".mode csv",
+				".headers on",
+				"select id, username from users;",
+				".mode json",
+				"select id, username from users;",
+				".mode jsonl",
+				"select id, username from users where id = 1;",
+				".mode markdown",
+				"select max(email) from users where id = 3;",
+				".mode line",
+				"select id, username from users;",
+				".mode tuple",
+				".nullvalue -",
+				"select max(id) from users where id = 3;",
+				".mode",
+				".mode html",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >db >+----+----------+",
+					"| id | username |",
+					"+----+----------+",
+					"| 1  | user1    |",
+					"| 2  | user,2   |",
+					"+----+----------+",
+					"Executed.",
+					"db >db >db >id,username\r",
+					"1,user1\r",
+					"2,\"user,2\"\r",
+					"Executed.",
+					"db >db >[{\"id\":1,\"username\":\"user1\"},",
+					"{\"id\":2,\"username\":\"user,2\"}]",
+					"Executed.",
+					"db >db >{\"id\":1,\"username\":\"user1\"}",
+					"Executed.",
+					"db >db >| max(email) |",
+					"|------------|",
+					"| NULL       |",
+					"Executed.",
+					"db >db >      id = 1",
+					"username = user1",
+					"",
+					"      id = 2",
+					"username = user,2",
+					"Executed.",
+					"db >db >db >(max(id))",
+					"(-)",
+					"Executed.",
+					"db >current output mode: tuple",
+					"db >Invalid arguments to '.mode html'",
+					"db >",
+				},
+			)
+		})
+
+		Convey("imports csv and jsonl files", func() {
+			csvFile, jsonlFile := "tmp_import.csv", "tmp_import.jsonl"
+			os.WriteFile(csvFile, []byte(
+				"email,id,username\n"+
+					"person1@example.com,1,user1\n"+
+					"\"person, 2\",2,user2\n"+
+					"person3@example.com,x,user3\n"+
+					"person4@example.com,1,user4\n"+
+					"person5@example.com,5\n"), 0644)
+			os.WriteFile(jsonlFile, []byte(
+				`{"id": 3, "username": "user3", "email": "person3@example.com"}`+"\n"+
+					"\n"+
+					`{"id": "4", "username": "user4"}`+"\n"+
+					`{"id": 6.0, "username": "user6", "email": "person6@example.com"}`+"\n"), 0644)
+			cmds := []string{
+				".import " + csvFile + " users",
+				".import " + jsonlFile + " users",
+				".import " + csvFile + " people",
+				".import missing.csv users",
+				"select;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+				os.Remove(csvFile)
+				os.Remove(jsonlFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >" + csvFile + ":4: id: \"x\" is not an integer",
+					csvFile + ":5: duplicate key",
+					csvFile + ":6: expected 3 values, got 2",
+					"Imported 2 rows, 3 failed.",
+					"db >" + jsonlFile + ":3: no value for column email",
+					"Imported 2 rows, 1 failed.",
+					"db >Error: No such table.",
+					"db >Error: Cannot open file.",
+					"db >(1, user1, person1@example.com)",
+					"(2, user2, person, 2)",
+					"(3, user3, person3@example.com)",
+					"(6, user6, person6@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("dumps the database as statements that rebuild it", func() {
+			cmds := []string{
+				"insert 2 user2 person2@example.com;",
+				"insert into users (email, id, username) values ('it''s me', 1, 'user one');",
+				"insert into users values (3, 'user3');",
+				"insert into people values (3, 'user3', 'person3@example.com');",
+				"create unique index on users(email);",
+				"create table users (id integer, username varchar(32), email varchar(256));",
+				"create table if not exists users (id integer, username varchar(32), email varchar(256));",
+				"create table if not exists people (id integer);",
+				".dump",
+				".dump people",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >Syntax error. Could not parse statement.",
+					"db >Error: No such table.",
+					"db >Executed.",
+					"db >Error: Table already exists.",
+					"db >Executed.",
+					"db >Error: Only the users table is supported.",
+					"db >create table if not exists users (id integer, username varchar(32), email varchar(256));",
+					"create unique index users_email_idx on users(email);",
+					"begin;",
+					"insert into users values (2, 'user2', 'person2@example.com');",
+					"insert into users values (1, 'user one', 'it''s me');",
+					"commit;",
+					"db >Error: No such table.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("describes the tables and indexes", func() {
+			cmds := []string{
+				"create unique index on users(email);",
+				"create index by_name on users(username);",
+				".tables",
+				".schema",
+				".indexes users",
+				".schema people",
+				".indexes users extra",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >users",
+					"db >create table if not exists users (id integer, username varchar(32), email varchar(256));",
+					"create unique index users_email_idx on users(email);",
+					"create index by_name on users(username);",
+					"db >users_pkey",
+					"users_email_idx",
+					"by_name",
+					"db >Error: No such table.",
+					"db >Invalid arguments to '.indexes users extra'",
+					"db >",
+				},
+			)
+		})
+
+		Convey("shows how the data is stored", func() {
+			cmds := []string{
+				"insert 2 user2 person2@example.com;",
+				"insert 1 user1 person1@example.com;",
+				".btree",
+				".mode csv",
+				".headers on",
+				".pages",
+				".page 0",
+				".page 1",
+				".btree nope",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >users_pkey",
+					"`--node 0 leaf [1@1, 2@0]",
+					"db >db >db >page,type,used,free,fill\r",
+					"0,data,592,3256,15.4%\r",
+					"100,meta,432,3664,10.5%\r",
+					"db >00000000  02 00 00 00 00 00 00 00  75 73 65 72 32 00 00 00  |........user2...|",
+					"00000010  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+					"00000020  00 00 00 00 00 00 00 00  70 65 72 73 6f 6e 32 40  |........person2@|",
+					"00000030  65 78 61 6d 70 6c 65 2e  63 6f 6d 00 00 00 00 00  |example.com.....|",
+					"00000040  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+					"*",
+					"00000120  00 00 00 00 00 00 00 00  01 00 00 00 00 00 00 00  |................|",
+					"00000130  75 73 65 72 31 00 00 00  00 00 00 00 00 00 00 00  |user1...........|",
+					"00000140  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+					"00000150  70 65 72 73 6f 6e 31 40  65 78 61 6d 70 6c 65 2e  |person1@example.|",
+					"00000160  63 6f 6d 00 00 00 00 00  00 00 00 00 00 00 00 00  |com.............|",
+					"00000170  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+					"*",
+					"00000ff0  00 00 00 00 00 00 00 00  00 00 00 00 00 00 00 00  |................|",
+					"00001000",
+					"db >Invalid arguments to '.page 1'",
+					"db >Error: No such index.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("checks the integrity of the database", func() {
+			cmds := []string{
+				"insert 1 user1 person1@example.com;",
+				"create unique index on users(email);",
+				".check",
+				"pragma integrity_check;",
+				"pragma nothing;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Executed.",
+					"db >ok",
+					"db >(ok)",
+					"Executed.",
+					"db >Syntax error. Could not parse statement.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("backs up and restores the database", func() {
+			backupFile := "tmp_backup.db"
+			junkFile := "tmp_junk.db"
+			os.WriteFile(junkFile, []byte("not a database"), 0644)
+			cmds := []string{
+				"insert 1 user1 person1@example.com;",
+				".backup " + backupFile,
+				"insert 2 user2 person2@example.com;",
+				"begin;",
+				".restore " + backupFile,
+				"rollback;",
+				".restore " + backupFile,
+				"select;",
+				".restore missing.db",
+				".restore " + junkFile,
+				".backup no/such/dir/backup.db",
+				".backup ./" + dbFile,
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+				os.Remove(backupFile)
+				os.Remove(junkFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >db >Executed.",
+					"db >Executed.",
+					"db >Error: Cannot restore within a transaction.",
+					"db >Executed.",
+					"db >db >(1, user1, person1@example.com)",
+					"Executed.",
+					"db >Error: Cannot open file.",
+					"db >Error: Not a valid backup.",
+					"db >Error: Cannot open file.",
+					"db >Error: Cannot back up a database onto itself.",
+					"db >",
+				},
+			)
+		})
+
+		Convey("runs commands without a prompt when not interactive", func() {
+			scriptFile := "tmp_script.sql"
+			os.WriteFile(scriptFile, []byte(
+				"insert 2 user2 person2@example.com;\n"+
+					"\n"+
+					"insert 2 user2 person2@example.com;\n"+
+					"select"), 0644)
+			defer func() {
+				os.Remove(dbFile)
+				os.Remove(scriptFile)
+			}()
+
+			output, code := runArgs([]string{dbFile}, "insert 1 user1 person1@example.com;\nselect;\n")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldResemble, []string{
+				"Executed.",
+				"(1, user1, person1@example.com)",
+				"Executed.",
+				"",
+			})
+
+			output, code = runArgs([]string{"-f", scriptFile, "-c", "select id from users", dbFile}, "")
+			So(code, ShouldEqual, 1)
+			So(output, ShouldResemble, []string{
+				"Executed.",
+				"Error: Duplicate key.",
+				"(1, user1, person1@example.com)",
+				"(2, user2, person2@example.com)",
+				"Executed.",
+				"(1)",
+				"(2)",
+				"Executed.",
+				"",
+			})
+
+			output, code = runArgs([]string{"-c", "select id from users where id = 2", dbFile}, "")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldResemble, []string{
+				"(2)",
+				"Executed.",
+				"",
+			})
+
+			output, code = runArgs([]string{"-bail", "-c", "insert 1 a b", "-c", "select", dbFile}, "")
+			So(code, ShouldEqual, 1)
+			So(output, ShouldResemble, []string{
+				"Error: Duplicate key.",
+				"",
+			})
+
+			// .exit stops the commands, but still
+			// tells that one of them failed
+			os.WriteFile(scriptFile, []byte(
+				"insert 2 user2 person2@example.com;\n"+
+					".exit\n"+
+					"select;\n"), 0644)
+			output, code = runArgs([]string{"-f", scriptFile, "-c", "select", dbFile}, "")
+			So(code, ShouldEqual, 1)
+			So(output, ShouldResemble, []string{
+				"Error: Duplicate key.",
+				"",
+			})
+
+			output, code = runArgs([]string{"-c", "insert 1 a b", "-c", ".exit", "-c", "select", dbFile}, "")
+			So(code, ShouldEqual, 1)
+			So(output, ShouldResemble, []string{
+				"Error: Duplicate key.",
+				"",
+			})
+
+			output, code = runArgs([]string{"-c", "select id from users where id = 1", "-c", ".exit", dbFile}, "")
+			So(code, ShouldEqual, 0)
+			So(output, ShouldResemble, []string{
+				"(1)",
+				"Executed.",
+				"",
+			})
+		})
+
+		Convey("runs statements that end at a semicolon", func() {
+			cmds := []string{
+				"insert 1 user1 person1@example.com; insert 2 user2 person2@example.com;",
+				"select id, username -- not email;",
+				"  from users /* where id = 1;",
+				"  */ where id = 2",
+				";",
+				"insert into users values (3, 'user;3',",
+				"'line",
+				"break');",
+				"select username, email from users where id = 3;",
+				";;",
+				".exit",
+			}
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+
+			So(
+				output,
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"Executed.",
+					"db >...>...>...>(2, user2)",
+					"Executed.",
+					"db >...>...>Executed.",
+					"db >(user;3, line",
+					"break)",
+					"Executed.",
+					"db >db >",
+				},
+			)
+		})
+
+		Convey("prints an error message when the catalog is full", func() {
+			cmds := []string{}
+			for i := 1; i <= 60; i++ {
+				cmds = append(cmds, "create index a_long_index_name_to_fill_up_the_catalog_"+strconv.Itoa(i)+" on users(email);")
+			}
+			cmds = append(cmds, "insert 1 user1 person1@example.com;", ".exit")
+			output := runCommands(cmds, dbFile)
+			defer func() {
+				os.Remove(dbFile)
+			}()
+			So(output, ShouldContain, "db >Error: The catalog is full.")
+			So(output[len(output)-2:], ShouldResemble, []string{"db >Executed.", "db >"})
+		})
+
+		Convey("reports a locked database to meta commands", func() {
+			defer func() {
+				os.Remove(dbFile)
+			}()
+			first := startShell(dbFile)
+			So(first.run("insert 1 user1 person1@example.com;"), ShouldResemble, []string{"db >Executed."})
+
+			// stage a restore of the same rows, as if
+			// another process crashed in the middle of it
+			const (
+				pageSize   = 4096
+				metaOffset = 100 * pageSize
+			)
+			b, err := os.ReadFile(dbFile)
+			So(err, ShouldBeNil)
+			f, err := os.OpenFile(dbFile, os.O_RDWR, 0600)
+			So(err, ShouldBeNil)
+			f.WriteAt(b[:pageSize], metaOffset+2*pageSize)
+			f.WriteAt(b[metaOffset:metaOffset+pageSize], metaOffset+pageSize)
+			f.Close()
+
+			So(
+				first.run(".schema", ".indexes", ".dump", ".check", ".backup tmp_backup.db"),
+				ShouldResemble,
+				[]string{
+					"db >Error: database is locked.",
+					"db >Error: database is locked.",
+					"db >Error: database is locked.",
+					"db >Error: database is locked.",
+					"db >Error: database is locked.",
+				},
+			)
+			So(first.exit(".exit"), ShouldResemble, []string{"db >"})
+
+			// opening the database finishes the restore
+			So(
+				runCommands([]string{"insert 2 user2 person2@example.com;", ".backup .", "select;", ".exit"}, dbFile),
+				ShouldResemble,
+				[]string{
+					"db >Executed.",
+					"db >Error: Cannot open file.",
+					"db >(1, user1, person1@example.com)",
+					"(2, user2, person2@example.com)",
+					"Executed.",
+					"db >",
+				},
+			)
+		})
+
 		Convey("keeps data after closing connection", func() {
 
 			Convey("insert one item and close connection", func() {
 				cmds := []string{
-					"insert 1 user1 person1@example.com",
+					"insert 1 user1 person1@example.com;",
 					".exit",
 				}
 				output := runCommands(cmds, dbFile)
@@ -162,7 +1136,7 @@ func TestSpec(t *testing.T) {
 			})
 			Convey("the item exists in a new connection", func() {
 				cmds := []string{
-					"select",
+					"select;",
 					".exit",
 				}
 				output := runCommands(cmds, dbFile)
@@ -178,7 +1152,7 @@ func TestSpec(t *testing.T) {
 			Convey("insert 20 items and close connection", func() {
 				cmds := []string{}
 				for i := 1; i <= 20; i++ {
-					cmds = append(cmds, "insert "+strconv.Itoa(i)+" user1 person1@example.com")
+					cmds = append(cmds, "insert "+strconv.Itoa(i)+" user1 person1@example.com;")
 				}
 				cmds = append(cmds, ".exit")
 				output := runCommands(cmds, dbFile)
@@ -190,7 +1164,7 @@ func TestSpec(t *testing.T) {
 			})
 			Convey("20th item exists in a new connection", func() {
 				cmds := []string{
-					"select",
+					"select;",
 					".exit",
 				}
 				output := runCommands(cmds, dbFile)
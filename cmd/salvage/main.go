@@ -0,0 +1,111 @@
+// Command salvage recovers what it can from a damaged
+// database file. It reads the file page by page and keeps
+// every row that decodes cleanly, writing them either to
+// a new database or as sql that the shell can replay:
+//
+//	salvage -o recovered.db damaged.db
+//	salvage damaged.db > recovered.sql
+//
+// What could not be recovered is reported on stderr
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"io"
+	"log"
+	"os"
+)
+
+// writeSQL writes the statements that rebuild s
+func writeSQL(w io.Writer, s *table.Salvaged) error {
+	lines := []string{statement.CreateTable() + ";"}
+	for _, def := range s.Indexes {
+		lines = append(lines, statement.CreateIndex(def)+";")
+	}
+	lines = append(lines, "begin;")
+	for _, r := range s.Rows {
+		values := []interface{}{}
+		for _, c := range table.Columns {
+			v, _ := r.Value(c.Name)
+			values = append(values, v)
+		}
+		lines = append(lines, statement.InsertValues(values)+";")
+	}
+	lines = append(lines, "commit;")
+	bw := bufio.NewWriter(w)
+	for _, l := range lines {
+		if _, err := bw.WriteString(l + "\n"); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+// writeDb writes s to a new database at path
+func writeDb(path string, s *table.Salvaged) error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	t, err := table.OpenDb(path)
+	if err != nil {
+		return err
+	}
+	defer t.CloseDb()
+	ctx := context.Background()
+	tx, err := t.Begin()
+	if err != nil {
+		return err
+	}
+	for _, r := range s.Rows {
+		if err := tx.Insert(ctx, r); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	for _, def := range s.Indexes {
+		if err := t.CreateIndex(ctx, def); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func main() {
+	out := flag.String("o", "", "write the rows to a new database `file` instead of sql to stdout")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: salvage [-o file] damaged.db\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	log.SetFlags(0)
+	log.SetPrefix("salvage: ")
+
+	s, err := table.Salvage(flag.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, p := range s.Problems {
+		log.Print(p)
+	}
+	if *out != "" {
+		err = writeDb(*out, s)
+	} else {
+		err = writeSQL(os.Stdout, s)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("recovered %d rows and %d indexes, %d problems", len(s.Rows), len(s.Indexes), len(s.Problems))
+}
@@ -0,0 +1,506 @@
+// Package lineedit reads lines typed at a terminal, letting the
+// user move around and edit them before hitting enter. Lines
+// that were entered are kept in a history, which can be walked
+// with the arrow keys or searched with Ctrl-R, and the word at
+// the cursor is completed with Tab.
+//
+// The keys are the usual emacs ones:
+//
+//	Left, Ctrl-B   Right, Ctrl-F    move by a character
+//	Home, Ctrl-A   End, Ctrl-E      move to the start or end
+//	Backspace      Delete, Ctrl-D   delete a character
+//	Ctrl-W         Ctrl-K, Ctrl-U   delete the word before, the rest, the start
+//	Up, Ctrl-P     Down, Ctrl-N     walk the history
+//	Ctrl-R         Tab              search the history, complete
+//	Ctrl-L         Ctrl-C           clear the screen, drop the line
+//
+// Lines that don't fit on the screen scroll sideways
+package lineedit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+)
+
+var (
+	// ErrInterrupted is returned when the user
+	// drops the line they were typing with Ctrl-C
+	ErrInterrupted = errors.New("interrupted")
+	// ErrUnsupported is returned by New when the
+	// input can't be read a key at a time
+	ErrUnsupported = errors.New("line editing is not supported")
+)
+
+// maxHistory is the number of lines
+// kept from earlier sessions
+const maxHistory = 1000
+
+// keys that aren't runes of their own. They are
+// told apart from runes by being negative
+const (
+	keyUp rune = -1 - iota
+	keyDown
+	keyLeft
+	keyRight
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// control characters
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	lineFeed  = 10
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	escape    = 27
+	backspace = 127
+)
+
+// Editor reads lines from a terminal
+type Editor struct {
+	in  *os.File
+	r   *bufio.Reader
+	out io.Writer
+	// width of the terminal, zero if unknown
+	width int
+
+	// Complete returns the words that word, the
+	// start of the word at the cursor, may be
+	// completed to. before is the text in front
+	// of it. Completion is off while it is nil
+	Complete func(before, word string) []string
+
+	history []string
+	// historyFile is where lines are saved as they
+	// are entered. Empty if they are not saved
+	historyFile string
+}
+
+// New returns an editor of the terminal at in, which it
+// echoes to out. The history is loaded from historyFile,
+// if there is one, and entered lines are appended to it.
+// It fails with ErrUnsupported if in is not a terminal
+func New(in, out *os.File, historyFile string) (*Editor, error) {
+	if _, err := getState(in.Fd()); err != nil {
+		return nil, ErrUnsupported
+	}
+	e := &Editor{
+		in:          in,
+		r:           bufio.NewReader(in),
+		out:         out,
+		historyFile: historyFile,
+	}
+	if err := e.loadHistory(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// ReadLine prints prompt and returns the line the user
+// enters, without its line break. It returns io.EOF when
+// the user hits Ctrl-D on an empty line, and
+// ErrInterrupted when they hit Ctrl-C
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	fd := e.in.Fd()
+	old, err := makeRaw(fd)
+	if err != nil {
+		return "", err
+	}
+	defer setState(fd, old)
+	e.width = termWidth(fd)
+	line, err := e.edit(prompt)
+	if err != nil {
+		return "", err
+	}
+	e.addHistory(line)
+	return line, nil
+}
+
+// loadHistory reads the last lines of the history file
+func (e *Editor) loadHistory() error {
+	if e.historyFile == "" {
+		return nil
+	}
+	f, err := os.Open(e.historyFile)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := scanner.Text(); line != "" {
+			e.history = append(e.history, line)
+		}
+	}
+	if len(e.history) > maxHistory {
+		e.history = e.history[len(e.history)-maxHistory:]
+	}
+	return scanner.Err()
+}
+
+// addHistory adds line to the history, unless it is blank
+// or the same as the line before it. The history file is
+// only a convenience, so failing to write it is ignored
+func (e *Editor) addHistory(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if n := len(e.history); n > 0 && e.history[n-1] == line {
+		return
+	}
+	e.history = append(e.history, line)
+	if e.historyFile == "" {
+		return
+	}
+	f, err := os.OpenFile(e.historyFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return
+	}
+	fmt.Fprintln(f, line)
+	f.Close()
+}
+
+// readKey reads a key off the terminal. Keys that send an
+// escape sequence are turned into one of the key constants
+func (e *Editor) readKey() (rune, error) {
+	r, _, err := e.r.ReadRune()
+	if err != nil || r != escape {
+		return r, err
+	}
+	r, _, err = e.r.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	switch r {
+	case '[':
+		// parameters, then a final byte: ESC [ 3 ~
+		params := []rune{}
+		for {
+			r, _, err = e.r.ReadRune()
+			if err != nil {
+				return 0, err
+			}
+			if r >= 0x40 && r <= 0x7e {
+				break
+			}
+			params = append(params, r)
+		}
+		if r == '~' {
+			switch string(params) {
+			case "1", "7":
+				return keyHome, nil
+			case "4", "8":
+				return keyEnd, nil
+			case "3":
+				return keyDelete, nil
+			}
+			return keyUnknown, nil
+		}
+	case 'O':
+		r, _, err = e.r.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return keyUnknown, nil
+	}
+	switch r {
+	case 'A':
+		return keyUp, nil
+	case 'B':
+		return keyDown, nil
+	case 'C':
+		return keyRight, nil
+	case 'D':
+		return keyLeft, nil
+	case 'H':
+		return keyHome, nil
+	case 'F':
+		return keyEnd, nil
+	}
+	return keyUnknown, nil
+}
+
+// edit lets the user edit a line after prompt
+// until they enter it
+func (e *Editor) edit(prompt string) (string, error) {
+	var buf []rune
+	pos := 0
+	// histPos is the line of the history being
+	// shown. Past the end is the new line, which
+	// is kept in draft while another is shown
+	histPos := len(e.history)
+	var draft []rune
+	tabs := 0
+
+	e.refresh(prompt, buf, pos)
+	for {
+		k, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+		if k == ctrlR {
+			buf, pos, k, err = e.search(prompt, buf, pos)
+			if err != nil {
+				return "", err
+			}
+			histPos = len(e.history)
+		}
+		if k == tab {
+			tabs++
+		} else {
+			tabs = 0
+		}
+
+		switch k {
+		case enter, lineFeed:
+			e.write("\n")
+			return string(buf), nil
+		case ctrlC:
+			e.write("^C\n")
+			return "", ErrInterrupted
+		case ctrlD:
+			if len(buf) == 0 {
+				e.write("\n")
+				return "", io.EOF
+			}
+			fallthrough
+		case keyDelete:
+			if pos < len(buf) {
+				buf = append(buf[:pos], buf[pos+1:]...)
+			}
+		case backspace, ctrlH:
+			if pos > 0 {
+				buf = append(buf[:pos-1], buf[pos:]...)
+				pos--
+			}
+		case ctrlW:
+			start := pos
+			for start > 0 && unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			for start > 0 && !unicode.IsSpace(buf[start-1]) {
+				start--
+			}
+			buf = append(buf[:start], buf[pos:]...)
+			pos = start
+		case ctrlK:
+			buf = buf[:pos]
+		case ctrlU:
+			buf = append([]rune{}, buf[pos:]...)
+			pos = 0
+		case ctrlA, keyHome:
+			pos = 0
+		case ctrlE, keyEnd:
+			pos = len(buf)
+		case ctrlB, keyLeft:
+			if pos > 0 {
+				pos--
+			}
+		case ctrlF, keyRight:
+			if pos < len(buf) {
+				pos++
+			}
+		case ctrlP, keyUp, ctrlN, keyDown:
+			next := histPos - 1
+			if k == ctrlN || k == keyDown {
+				next = histPos + 1
+			}
+			if next < 0 || next > len(e.history) {
+				e.write("\a")
+				continue
+			}
+			if histPos == len(e.history) {
+				draft = buf
+			}
+			histPos = next
+			if histPos == len(e.history) {
+				buf = draft
+			} else {
+				buf = []rune(e.history[histPos])
+			}
+			pos = len(buf)
+		case ctrlL:
+			e.write("\x1b[H\x1b[2J")
+		case tab:
+			buf, pos = e.complete(prompt, buf, pos, tabs > 1)
+		default:
+			if k < ' ' || k == backspace {
+				// a key we don't handle
+				continue
+			}
+			buf = append(buf[:pos], append([]rune{k}, buf[pos:]...)...)
+			pos++
+		}
+		e.refresh(prompt, buf, pos)
+	}
+}
+
+// search searches the history for lines holding what the
+// user types, starting with the latest. Ctrl-R moves on to
+// an earlier match, and Ctrl-G gives up, going back to buf.
+// Any other key takes the match and is returned, to be
+// handled as if it were hit while editing the match
+func (e *Editor) search(prompt string, buf []rune, pos int) ([]rune, int, rune, error) {
+	var query []rune
+	match := len(e.history)
+	// find finds the latest match at or before from
+	find := func(from int) bool {
+		for i := from; i >= 0; i-- {
+			if i < len(e.history) && strings.Contains(e.history[i], string(query)) {
+				match = i
+				return true
+			}
+		}
+		return false
+	}
+	found := true
+	for {
+		line := ""
+		at := 0
+		if match < len(e.history) {
+			line = e.history[match]
+			at = strings.Index(line, string(query))
+			if at < 0 {
+				at = 0
+			}
+		}
+		searchPrompt := "(reverse-i-search)`" + string(query) + "': "
+		if !found {
+			searchPrompt = "(failing " + searchPrompt[1:]
+		}
+		e.refresh(searchPrompt, []rune(line), len([]rune(line[:at])))
+
+		k, err := e.readKey()
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		switch {
+		case k == ctrlR:
+			found = len(query) > 0 && find(match-1)
+		case k == backspace || k == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			match = len(e.history)
+			found = len(query) == 0 || find(len(e.history)-1)
+		case k == ctrlG:
+			e.refresh(prompt, buf, pos)
+			return buf, pos, keyUnknown, nil
+		case k >= ' ' && k != backspace:
+			query = append(query, k)
+			found = find(match)
+		default:
+			if match == len(e.history) {
+				return buf, pos, k, nil
+			}
+			matched := []rune(e.history[match])
+			return matched, len([]rune(line[:at])), k, nil
+		}
+	}
+}
+
+// complete completes the word that ends at pos. A single
+// candidate is filled in whole, several are filled in as
+// far as they agree. Once they can't be filled in any
+// further, a second Tab lists them
+func (e *Editor) complete(prompt string, buf []rune, pos int, again bool) ([]rune, int) {
+	if e.Complete == nil {
+		return buf, pos
+	}
+	start := pos
+	for start > 0 && isWordRune(buf[start-1]) {
+		start--
+	}
+	candidates := e.Complete(string(buf[:start]), string(buf[start:pos]))
+	if len(candidates) == 0 {
+		e.write("\a")
+		return buf, pos
+	}
+	fill := []rune(candidates[0])
+	if len(candidates) == 1 {
+		fill = append(fill, ' ')
+	}
+	for _, c := range candidates[1:] {
+		fill = commonPrefix(fill, []rune(c))
+	}
+	if len(fill) <= pos-start {
+		// nothing more to fill in
+		if again {
+			e.write("\n" + strings.Join(candidates, "  ") + "\n")
+		} else {
+			e.write("\a")
+		}
+		return buf, pos
+	}
+	rest := append([]rune{}, buf[pos:]...)
+	buf = append(append(buf[:start], fill...), rest...)
+	return buf, start + len(fill)
+}
+
+// isWordRune reports whether r is part of a word
+// that can be completed
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_' || r == '.'
+}
+
+// commonPrefix returns the start that a and b share,
+// ignoring case. It is taken from a
+func commonPrefix(a, b []rune) []rune {
+	n := 0
+	for n < len(a) && n < len(b) && unicode.ToLower(a[n]) == unicode.ToLower(b[n]) {
+		n++
+	}
+	return a[:n]
+}
+
+// refresh redraws the line, with the cursor at pos.
+// A line too long for the terminal is scrolled so
+// that the cursor stays in sight
+func (e *Editor) refresh(prompt string, buf []rune, pos int) {
+	shown := buf
+	cursor := pos
+	if room := e.width - len([]rune(prompt)) - 1; e.width > 0 && room > 0 {
+		if pos > room {
+			shown = shown[pos-room:]
+			cursor = room
+		}
+		if len(shown) > room {
+			shown = shown[:room]
+		}
+	}
+	var b strings.Builder
+	b.WriteString("\r" + prompt + string(shown) + "\x1b[K")
+	if back := len(shown) - cursor; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+	e.write(b.String())
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
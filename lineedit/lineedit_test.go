@@ -0,0 +1,193 @@
+package lineedit
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const (
+	up    = "\x1b[A"
+	down  = "\x1b[B"
+	left  = "\x1b[D"
+	right = "\x1b[C"
+	del   = "\x1b[3~"
+)
+
+// fakeEditor returns an editor that reads
+// keys and writes what it echoes to out
+func fakeEditor(keys string, history ...string) (*Editor, *bytes.Buffer) {
+	out := &bytes.Buffer{}
+	return &Editor{
+		r:       bufio.NewReader(strings.NewReader(keys)),
+		out:     out,
+		history: history,
+	}, out
+}
+
+func TestEdit(t *testing.T) {
+	cases := []struct {
+		keys string
+		want string
+	}{
+		{"selct" + left + left + "e\r", "select"},
+		{"elect\x01s\x05 *\x7f\x7f\r", "select"},
+		{"select id from\x17\x17\r", "select "},
+		{"select id" + left + left + "\x0b\r", "select "},
+		{"select id" + left + left + "\x15\r", "id"},
+		{"xselect\x01" + del + "\x1b[F" + right + "\x04\r", "select"},
+		{"한글" + left + "a\r", "한a글"},
+	}
+	for _, c := range cases {
+		e, _ := fakeEditor(c.keys)
+		line, err := e.edit("db >")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("Expected %q after %q, got %q", c.want, c.keys, line)
+		}
+	}
+
+	e, _ := fakeEditor("sel\x03")
+	if _, err := e.edit("db >"); err != ErrInterrupted {
+		t.Fatalf("Expected Ctrl-C to interrupt, got %v", err)
+	}
+	e, _ = fakeEditor("\x04")
+	if _, err := e.edit("db >"); err != io.EOF {
+		t.Fatalf("Expected Ctrl-D on an empty line to end the input, got %v", err)
+	}
+}
+
+func TestHistory(t *testing.T) {
+	history := []string{"select", "insert 1 a b"}
+	cases := []struct {
+		keys string
+		want string
+	}{
+		{up + "\r", "insert 1 a b"},
+		{up + up + up + "\r", "select"},
+		{up + up + down + "\r", "insert 1 a b"},
+		{"sel" + up + down + "\r", "sel"},
+		{"\x10\x10 id\r", "select id"},
+	}
+	for _, c := range cases {
+		e, _ := fakeEditor(c.keys, history...)
+		line, err := e.edit("db >")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("Expected %q after %q, got %q", c.want, c.keys, line)
+		}
+	}
+
+	file := filepath.Join(t.TempDir(), "history")
+	e := &Editor{historyFile: file}
+	for _, line := range []string{"select", "select", " ", "begin"} {
+		e.addHistory(line)
+	}
+	loaded := &Editor{historyFile: file}
+	if err := loaded.loadHistory(); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"select", "begin"}; !reflect.DeepEqual(loaded.history, want) {
+		t.Fatalf("Expected %q, got %q", want, loaded.history)
+	}
+	b, err := os.ReadFile(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != "select\nbegin\n" {
+		t.Fatalf("Expected each line once in the file, got %q", b)
+	}
+}
+
+func TestSearch(t *testing.T) {
+	history := []string{"select id from users", "insert 1 a b", "select email from users"}
+	cases := []struct {
+		keys string
+		want string
+	}{
+		{"\x12sel\r", "select email from users"},
+		{"\x12sel\x12\r", "select id from users"},
+		{"\x12id\x7f\x7fins\r", "insert 1 a b"},
+		{"\x12email\x05 where id = 1\r", "select email from users where id = 1"},
+		{"typed\x12zzz\x07\r", "typed"},
+	}
+	for _, c := range cases {
+		e, _ := fakeEditor(c.keys, history...)
+		line, err := e.edit("db >")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("Expected %q after %q, got %q", c.want, c.keys, line)
+		}
+	}
+
+	e, out := fakeEditor("\x12zzz\x07\r", history...)
+	if _, err := e.edit("db >"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "(failing reverse-i-search)`zzz': ") {
+		t.Fatalf("Expected the search to fail, got %q", out.String())
+	}
+}
+
+func TestComplete(t *testing.T) {
+	complete := func(before, word string) []string {
+		matches := []string{}
+		for _, w := range []string{"savepoint", "select", "users"} {
+			if strings.HasPrefix(w, word) && (before == "" || w == "users") {
+				matches = append(matches, w)
+			}
+		}
+		return matches
+	}
+	cases := []struct {
+		keys string
+		want string
+	}{
+		{"sel\t\r", "select "},
+		{"select * from u\t\r", "select * from users "},
+		{"select x\t\r", "select x"},
+		{"s\t\r", "s"},
+		{"sa\tx\r", "savepoint x"},
+		{"from\x01sa\t\r", "savepoint from"},
+	}
+	for _, c := range cases {
+		e, _ := fakeEditor(c.keys)
+		e.Complete = complete
+		line, err := e.edit("db >")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if line != c.want {
+			t.Errorf("Expected %q after %q, got %q", c.want, c.keys, line)
+		}
+	}
+
+	e, out := fakeEditor("s\t\t\r")
+	e.Complete = complete
+	if _, err := e.edit("db >"); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out.String(), "\nsavepoint  select\n") {
+		t.Fatalf("Expected a second tab to list the candidates, got %q", out.String())
+	}
+}
+
+func TestScroll(t *testing.T) {
+	e, out := fakeEditor("")
+	e.width = 10
+	e.refresh("db >", []rune("select id from users"), 20)
+	if want := "\rdb >users\x1b[K"; out.String() != want {
+		t.Fatalf("Expected %q, got %q", want, out.String())
+	}
+}
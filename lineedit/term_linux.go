@@ -0,0 +1,70 @@
+//go:build linux
+// +build linux
+
+package lineedit
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// termState holds the settings of a terminal
+type termState syscall.Termios
+
+func ioctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, fd, req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// getState returns the settings of the terminal at fd.
+// It fails if fd is not a terminal
+func getState(fd uintptr) (*termState, error) {
+	var s termState
+	if err := ioctl(fd, syscall.TCGETS, unsafe.Pointer(&s)); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// setState puts back settings returned by getState
+func setState(fd uintptr, s *termState) error {
+	return ioctl(fd, syscall.TCSETS, unsafe.Pointer(s))
+}
+
+// makeRaw has the terminal at fd hand over every key as it
+// is hit, without echoing it or acting on it, and returns
+// the settings it had before. Output is left as it is, so
+// that a line feed still starts a new line
+func makeRaw(fd uintptr) (*termState, error) {
+	old, err := getState(fd)
+	if err != nil {
+		return nil, err
+	}
+	raw := *old
+	raw.Iflag &^= syscall.IGNBRK | syscall.BRKINT | syscall.PARMRK | syscall.ISTRIP |
+		syscall.INLCR | syscall.IGNCR | syscall.ICRNL | syscall.IXON
+	raw.Lflag &^= syscall.ECHO | syscall.ECHONL | syscall.ICANON | syscall.ISIG | syscall.IEXTEN
+	raw.Cflag &^= syscall.CSIZE | syscall.PARENB
+	raw.Cflag |= syscall.CS8
+	raw.Cc[syscall.VMIN] = 1
+	raw.Cc[syscall.VTIME] = 0
+	if err := setState(fd, &raw); err != nil {
+		return nil, err
+	}
+	return old, nil
+}
+
+// termWidth returns the number of columns of the
+// terminal at fd, or zero if it can't tell
+func termWidth(fd uintptr) int {
+	var ws struct {
+		rows, cols, xPixels, yPixels uint16
+	}
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0
+	}
+	return int(ws.cols)
+}
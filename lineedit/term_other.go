@@ -0,0 +1,25 @@
+//go:build !linux
+// +build !linux
+
+package lineedit
+
+// Raw mode is only implemented for Linux terminals,
+// elsewhere lines are read as the terminal gives them
+
+type termState struct{}
+
+func getState(fd uintptr) (*termState, error) {
+	return nil, ErrUnsupported
+}
+
+func setState(fd uintptr, s *termState) error {
+	return ErrUnsupported
+}
+
+func makeRaw(fd uintptr) (*termState, error) {
+	return nil, ErrUnsupported
+}
+
+func termWidth(fd uintptr) int {
+	return 0
+}
@@ -2,92 +2,437 @@ package main
 
 import (
 	"bufio"
+	"context"
+	"flag"
 	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/lineedit"
 	"github.com/sussadag/lets-build-a-simple-db/metacmd"
 	"github.com/sussadag/lets-build-a-simple-db/statement"
 	"github.com/sussadag/lets-build-a-simple-db/table"
 	"io"
 	"log"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 )
 
-func printPrompt() {
-	fmt.Printf("db >")
+const (
+	prompt = "db >"
+	// continuation prompts for the rest
+	// of an unfinished statement
+	continuation = "...>"
+)
+
+// source is where commands come from: the sql of a
+// -c flag, or the script file of a -f flag
+type source struct {
+	sql  string
+	file string
+}
+
+// sources collects the -c and -f flags in
+// the order they were given in
+type sources []source
+
+type sqlFlag struct{ s *sources }
+
+func (f sqlFlag) String() string { return "" }
+
+func (f sqlFlag) Set(v string) error {
+	*f.s = append(*f.s, source{sql: v})
+	return nil
+}
+
+type fileFlag struct{ s *sources }
+
+func (f fileFlag) String() string { return "" }
+
+func (f fileFlag) Set(v string) error {
+	*f.s = append(*f.s, source{file: v})
+	return nil
 }
 
-func getCommand(input *bufio.Reader) (text string) {
-	text, err := input.ReadString('\n')
-	if err == io.EOF {
-		os.Exit(0)
+// isTerminal reports whether f is a terminal
+func isTerminal(f *os.File) bool {
+	fileInfo, err := f.Stat()
+	return err == nil && fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// statementContext returns the context a single statement runs
+// under. It is cancelled when the statement runs for longer than
+// timeout (if non-zero) or when the user hits Ctrl-C
+func statementContext(timeout time.Duration, interrupts <-chan os.Signal) (context.Context, context.CancelFunc) {
+	// forget about any Ctrl-C hit while no statement was running
+	select {
+	case <-interrupts:
+	default:
 	}
-	if err != nil {
-		log.Fatal(err)
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	} else {
+		ctx, cancel = context.WithCancel(context.Background())
 	}
-	return strings.Replace(text, "\n", "", -1)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return ctx, cancel
 }
 
-func getDbFileName() string {
-	if len(os.Args) < 2 {
-		log.Fatalf("Must supply a database filename")
+// shell runs the commands typed in
+// or scripted against the database
+type shell struct {
+	t          *table.Table
+	conn       *statement.Conn
+	settings   *metacmd.Settings
+	interrupts chan os.Signal
+	// bail stops the shell at the first error
+	bail bool
+	// failed is whether any command has failed
+	failed bool
+	// exited is set by .exit, after which
+	// no more commands are run
+	exited bool
+}
+
+// lineReader returns the next line of input, without its
+// line break, prompting for it with prompt. At the end of
+// the input it returns the last line, which may be empty,
+// along with io.EOF
+type lineReader func(prompt string) (string, error)
+
+// plainReader reads lines from r, printing
+// the prompt before each one if prompt is set
+func plainReader(r io.Reader, prompt bool) lineReader {
+	input := bufio.NewReader(r)
+	return func(p string) (string, error) {
+		if prompt {
+			fmt.Print(p)
+		}
+		line, err := input.ReadString('\n')
+		return strings.TrimSuffix(line, "\n"), err
 	}
-	return os.Args[1]
 }
 
-func main() {
-	dbFileName := getDbFileName()
-	input := bufio.NewReader(os.Stdin)
-	t, err := table.OpenDb(dbFileName)
+// historyFile returns where the line editor
+// keeps the lines entered, if anywhere
+func historyFile() string {
+	home, err := os.UserHomeDir()
 	if err != nil {
-		log.Fatalf("Failed to open the db: '%s'", err)
+		return ""
 	}
-	for {
-		printPrompt()
-		line := getCommand(input)
-		if strings.HasPrefix(line, ".") {
-			// handle meta command
-			if err := metacmd.Execute(line, t); err != nil {
-				switch err {
-				case metacmd.ErrUnrecognizedCmd:
-					fmt.Printf("Unrecognized command '%s'\n", line)
-				default:
-					log.Fatalf("Failed to execute command '%s'", err)
-				}
+	return filepath.Join(home, ".simpledb_history")
+}
+
+// completions returns the words that may complete word,
+// with before coming in front of it on the line: meta
+// commands at the start of the line, and otherwise
+// keywords and the names the catalog holds
+func (sh *shell) completions(before, word string) []string {
+	var words []string
+	if strings.TrimSpace(before) == "" && strings.HasPrefix(word, ".") {
+		words = metacmd.Commands
+	} else {
+		words = append(words, statement.Keywords...)
+		words = append(words, table.Name, table.PrimaryKey.Name)
+		for _, c := range table.Columns {
+			words = append(words, c.Name)
+		}
+		// the indexes may change while the shell
+		// runs, so they are looked up every time
+		if defs, err := sh.t.Indexes(); err == nil {
+			for _, def := range defs {
+				words = append(words, def.Name)
 			}
-			continue
 		}
-		// handle sql statement
-		s, err := statement.Prepare(line, t)
-		switch err {
-		case statement.ErrUnrecognizedStatement:
-			fmt.Printf("Unrecognized keyword at start of '%s'\n", line)
-			continue
-		case statement.ErrSyntaxError:
-			fmt.Println("Syntax error. Could not parse statement.")
-			continue
-		case statement.ErrStringTooLong:
-			fmt.Println("String is too long.")
-			continue
-		case statement.ErrNegativeId:
-			fmt.Println("ID must be positive.")
-			continue
+	}
+	matches := []string{}
+	for _, w := range words {
+		if strings.HasPrefix(strings.ToLower(w), strings.ToLower(word)) {
+			matches = append(matches, w)
+		}
+	}
+	sort.Strings(matches)
+	return matches
+}
+
+// runLines runs the meta commands and statements read by
+// next. A meta command takes up a line of its own, while
+// a statement ends at a ';' and may span several lines. A
+// statement that is left unfinished at the end of the
+// input runs as it is
+func (sh *shell) runLines(next lineReader) {
+	sp := &statement.Splitter{}
+	for {
+		p := prompt
+		if sp.Pending() {
+			p = continuation
 		}
-		if err != nil {
-			fmt.Printf("Unexpected error '%s", err)
+		line, err := next(p)
+		if err == lineedit.ErrInterrupted {
+			// drop the statement being typed
+			sp.Flush()
 			continue
 		}
+		if err != nil && err != io.EOF {
+			log.Fatal(err)
+		}
+		if !sp.Pending() && strings.HasPrefix(strings.TrimSpace(line), ".") {
+			sh.runOrBail(strings.TrimSpace(line))
+			if sh.exited {
+				return
+			}
+		} else {
+			for _, stmt := range sp.Feed(line + "\n") {
+				sh.runOrBail(stmt)
+			}
+		}
+		if err == io.EOF {
+			if stmt := sp.Flush(); stmt != "" {
+				sh.runOrBail(stmt)
+			}
+			return
+		}
+	}
+}
 
-		// Execute prepared statement
-		err = statement.Execute(s, t)
+// runOrBail runs line, and exits with a non-zero
+// code if that fails and the shell is to bail
+func (sh *shell) runOrBail(line string) {
+	if sh.run(line) {
+		return
+	}
+	sh.failed = true
+	if sh.bail {
+		sh.t.CloseDb()
+		os.Exit(1)
+	}
+}
+
+// run runs the meta command or statement in line and
+// prints how it went. It reports whether it succeeded
+func (sh *shell) run(line string) bool {
+	if strings.HasPrefix(line, ".") {
+		// handle meta command
+		ctx, cancel := statementContext(sh.settings.Timeout, sh.interrupts)
+		err := metacmd.Execute(ctx, line, sh.t, sh.conn, sh.settings)
+		cancel()
+		if err == nil {
+			return true
+		}
 		switch err {
+		case metacmd.ErrExit:
+			sh.exited = true
+			return true
+		case metacmd.ErrUnrecognizedCmd:
+			fmt.Printf("Unrecognized command '%s'\n", line)
+		case metacmd.ErrInvalidArgs:
+			fmt.Printf("Invalid arguments to '%s'\n", line)
+		case metacmd.ErrNoSuchTable:
+			fmt.Println("Error: No such table.")
+		case metacmd.ErrCannotOpen:
+			fmt.Println("Error: Cannot open file.")
+		case metacmd.ErrCannotRead:
+			fmt.Println("Error: Cannot read file.")
+		case metacmd.ErrRestoreInTx:
+			fmt.Println("Error: Cannot restore within a transaction.")
+		case metacmd.ErrBackupOntoDb:
+			fmt.Println("Error: Cannot back up a database onto itself.")
+		case metacmd.ErrBadBackup:
+			fmt.Println("Error: Not a valid backup.")
+		case statement.ErrDuplicateKey:
+			fmt.Println("Error: Duplicate key.")
 		case statement.ErrTableFull:
 			fmt.Println("Error: Table full.")
-			continue
-		}
-		if err != nil {
-			log.Fatalf("Error while executing statement: '%s'", err)
+		case statement.ErrNoSuchIndex:
+			fmt.Println("Error: No such index.")
+		case statement.ErrDatabaseLocked:
+			fmt.Println("Error: database is locked.")
+		case statement.ErrCatalogFull:
+			fmt.Println("Error: The catalog is full.")
+		case statement.ErrRestored:
+			fmt.Println("Error: The database was restored while being read.")
+		case context.Canceled:
+			fmt.Println("Error: Interrupted.")
+		case context.DeadlineExceeded:
+			fmt.Println("Error: Statement timed out.")
+		default:
+			fmt.Printf("Error: %s.\n", err)
 		}
-		fmt.Printf("Executed.\n")
+		return false
+	}
+	// handle sql statement
+	s, err := statement.Prepare(line, sh.t)
+	switch err {
+	case statement.ErrUnrecognizedStatement:
+		fmt.Printf("Unrecognized keyword at start of '%s'\n", line)
+		return false
+	case statement.ErrSyntaxError:
+		fmt.Println("Syntax error. Could not parse statement.")
+		return false
+	case statement.ErrStringTooLong:
+		fmt.Println("String is too long.")
+		return false
+	case statement.ErrNegativeId:
+		fmt.Println("ID must be positive.")
+		return false
+	case statement.ErrNoSuchTable:
+		fmt.Println("Error: No such table.")
+		return false
+	case statement.ErrNoSuchColumn:
+		fmt.Println("Error: No such column.")
+		return false
+	case statement.ErrTypeMismatch:
+		fmt.Println("Error: Value does not match the type of the column.")
+		return false
+	case statement.ErrSchemaChanged:
+		fmt.Println("Error: Only the users table is supported.")
+		return false
+	}
+	if err != nil {
+		fmt.Printf("Unexpected error '%s", err)
+		return false
+	}
+
+	// Execute prepared statement
+	ctx, cancel := statementContext(sh.settings.Timeout, sh.interrupts)
+	res, err := statement.Execute(ctx, s, sh.conn)
+	cancel()
+	switch err {
+	case statement.ErrTableFull:
+		fmt.Println("Error: Table full.")
+		return false
+	case statement.ErrDuplicateKey:
+		fmt.Println("Error: Duplicate key.")
+		return false
+	case statement.ErrNoTransaction:
+		fmt.Println("Error: No transaction is active.")
+		return false
+	case statement.ErrTransactionActive:
+		fmt.Println("Error: Cannot start a transaction within a transaction.")
+		return false
+	case statement.ErrNoSavepoint:
+		fmt.Println("Error: No such savepoint.")
+		return false
+	case statement.ErrDatabaseLocked:
+		fmt.Println("Error: database is locked.")
+		return false
+	case statement.ErrIndexExists:
+		fmt.Println("Error: Index already exists.")
+		return false
+	case statement.ErrNoSuchIndex:
+		fmt.Println("Error: No such index.")
+		return false
+	case statement.ErrSchemaInTx:
+		fmt.Println("Error: Cannot change the schema within a transaction.")
+		return false
+	case statement.ErrTableExists:
+		fmt.Println("Error: Table already exists.")
+		return false
+	case statement.ErrCatalogFull:
+		fmt.Println("Error: The catalog is full.")
+		return false
+	case statement.ErrRestored:
+		fmt.Println("Error: The database was restored while being read.")
+		return false
+	case context.Canceled:
+		fmt.Println("Error: Interrupted.")
+		return false
+	case context.DeadlineExceeded:
+		fmt.Println("Error: Statement timed out.")
+		return false
+	}
+	if err != nil {
+		log.Fatalf("Error while executing statement: '%s'", err)
+	}
+	if err := metacmd.Render(os.Stdout, res, sh.settings); err != nil {
+		log.Fatalf("Failed to print the result: '%s'", err)
+	}
+	fmt.Printf("Executed.\n")
+	return true
+}
+
+// newEditor returns a line editor for the shell, if
+// both stdin and stdout are terminals that support it
+func newEditor(sh *shell) (*lineedit.Editor, error) {
+	if !isTerminal(os.Stdout) || os.Getenv("TERM") == "dumb" {
+		return nil, lineedit.ErrUnsupported
+	}
+	ed, err := lineedit.New(os.Stdin, os.Stdout, historyFile())
+	if err != nil {
+		return nil, err
 	}
+	ed.Complete = sh.completions
+	return ed, nil
+}
 
+func main() {
+	var srcs sources
+	flag.Var(sqlFlag{&srcs}, "c", "run `sql`, a statement or meta command, then exit, with a non-zero exit code if any failed. May be repeated")
+	flag.Var(fileFlag{&srcs}, "f", "run the commands in `file`, then exit, with a non-zero exit code if any failed. May be repeated")
+	bail := flag.Bool("bail", false, "stop at the first error, with a non-zero exit code")
+	interactive := flag.Bool("interactive", false, "print the prompt even when stdin is not a terminal")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] dbfile\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		log.Fatalf("Must supply a database filename")
+	}
+
+	t, err := table.OpenDb(flag.Arg(0))
+	if err != nil {
+		log.Fatalf("Failed to open the db: '%s'", err)
+	}
+	sh := &shell{
+		t:        t,
+		conn:     statement.NewConn(t),
+		settings: metacmd.NewSettings(),
+		// Ctrl-C cancels the running statement
+		// instead of killing the shell
+		interrupts: make(chan os.Signal, 1),
+		bail:       *bail,
+	}
+	signal.Notify(sh.interrupts, os.Interrupt)
+
+	if len(srcs) > 0 {
+		for _, src := range srcs {
+			if sh.exited {
+				break
+			}
+			if src.file == "" {
+				sh.runLines(plainReader(strings.NewReader(src.sql), false))
+				continue
+			}
+			f, err := os.Open(src.file)
+			if err != nil {
+				log.Fatalf("Failed to open the script: '%s'", err)
+			}
+			sh.runLines(plainReader(f, false))
+			f.Close()
+		}
+	} else if ed, err := newEditor(sh); err == nil {
+		sh.runLines(ed.ReadLine)
+	} else {
+		// the prompt would only get in the way of
+		// output that is piped somewhere else
+		sh.runLines(plainReader(os.Stdin, *interactive || isTerminal(os.Stdin)))
+	}
+	if err := t.CloseDb(); err != nil {
+		log.Fatalf("Failed to close the database: '%s'", err)
+	}
+	if len(srcs) > 0 && sh.failed {
+		// scripts can tell that a command failed
+		os.Exit(1)
+	}
 }
@@ -0,0 +1,41 @@
+package metacmd
+
+import (
+	"context"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"io"
+)
+
+// dump writes the statements that rebuild the database
+// as c sees it: the table, its indexes, its rows in a
+// single transaction and, if they were gathered, its
+// statistics
+func dump(ctx context.Context, w io.Writer, t *table.Table, c *statement.Conn) error {
+	lines, err := schemaLines(t)
+	if err != nil {
+		return err
+	}
+	stats, err := t.Stats()
+	if err != nil {
+		return err
+	}
+	s, err := statement.Prepare("select", t)
+	if err != nil {
+		return err
+	}
+	res, err := statement.Execute(ctx, s, c)
+	if err != nil {
+		return err
+	}
+
+	lines = append(lines, "begin;")
+	for _, row := range res.Rows {
+		lines = append(lines, statement.InsertValues(row)+";")
+	}
+	lines = append(lines, "commit;")
+	if stats != nil {
+		lines = append(lines, "analyze "+table.Name+";")
+	}
+	return writeLines(w, lines)
+}
@@ -0,0 +1,237 @@
+package metacmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// record is a row read from a file to
+// import, before it is checked
+type record struct {
+	// line is where the row starts in the file
+	line int
+	// values by column name
+	values map[string]interface{}
+	// err is set if the row could not be read
+	err error
+}
+
+// importFile loads the rows of the csv or jsonl file at
+// path into the table, in a single transaction, and
+// reports to w the rows that could not be loaded, in
+// the order of their lines
+func importFile(ctx context.Context, w io.Writer, path, tableName string, c *statement.Conn) error {
+	if tableName != table.Name {
+		return ErrNoSuchTable
+	}
+	var read func(io.Reader) ([]record, error)
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		read = readCSV
+	case ".jsonl", ".ndjson":
+		read = readJSONLines
+	default:
+		return ErrInvalidArgs
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return ErrCannotOpen
+	}
+	defer f.Close()
+	records, err := read(bufio.NewReader(f))
+	if err != nil {
+		// a line too long to scan, or
+		// the file itself failing
+		return ErrCannotRead
+	}
+
+	problems := []importProblem{}
+	report := func(line int, err error) {
+		problems = append(problems, importProblem{line, err})
+	}
+	rows := []table.Row{}
+	// lines are the lines the rows start at
+	lines := []int{}
+	for _, rec := range records {
+		r, err := rec.row()
+		if err != nil {
+			report(rec.line, err)
+			continue
+		}
+		rows = append(rows, r)
+		lines = append(lines, rec.line)
+	}
+	n, err := c.InsertRows(ctx, rows, func(i int, err error) {
+		report(lines[i], err)
+	})
+	// rows that clash with others are only found once
+	// the rest are checked, so they are sorted in
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].line < problems[j].line
+	})
+	for _, p := range problems {
+		if _, err := fmt.Fprintf(w, "%s:%d: %s\n", path, p.line, p.err); err != nil {
+			return err
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "Imported %d rows, %d failed.\n", n, len(problems))
+	return err
+}
+
+// importProblem is a row that could
+// not be imported, and why
+type importProblem struct {
+	line int
+	err  error
+}
+
+// row checks the values of rec and coerces them
+// to the types of their columns
+func (rec record) row() (table.Row, error) {
+	if rec.err != nil {
+		return table.Row{}, rec.err
+	}
+	for name := range rec.values {
+		if !table.IsColumn(name) {
+			return table.Row{}, fmt.Errorf("no such column %q", name)
+		}
+	}
+	var id int64
+	var strs []string
+	for _, c := range table.Columns {
+		v, ok := rec.values[c.Name]
+		if !ok || v == nil {
+			return table.Row{}, fmt.Errorf("no value for column %s", c.Name)
+		}
+		if table.IsInteger(c.Name) {
+			var err error
+			if id, err = coerceInteger(v); err != nil {
+				return table.Row{}, fmt.Errorf("%s: %s", c.Name, err)
+			}
+			continue
+		}
+		strs = append(strs, coerceString(v))
+	}
+	return statement.NewRow(id, strs[0], strs[1])
+}
+
+// coerceInteger turns v into an integer. Strings are
+// parsed, and numbers must not have a fraction
+func coerceInteger(v interface{}) (int64, error) {
+	text := strings.TrimSpace(coerceString(v))
+	if i, err := strconv.ParseInt(text, 10, 64); err == nil {
+		return i, nil
+	}
+	f, err := strconv.ParseFloat(text, 64)
+	if err != nil || f != float64(int64(f)) {
+		return 0, fmt.Errorf("%q is not an integer", text)
+	}
+	return int64(f), nil
+}
+
+// coerceString turns v into text
+func coerceString(v interface{}) string {
+	if s, ok := v.(string); ok {
+		return s
+	}
+	return fmt.Sprint(v)
+}
+
+// isHeader reports whether fields name
+// every column of the table
+func isHeader(fields []string) bool {
+	seen := map[string]bool{}
+	for _, f := range fields {
+		name := strings.ToLower(strings.TrimSpace(f))
+		if !table.IsColumn(name) || seen[name] {
+			return false
+		}
+		seen[name] = true
+	}
+	return len(seen) == len(table.Columns)
+}
+
+// readCSV reads an RFC 4180 file. If the first record
+// names the columns, it tells which column each field
+// goes in. Otherwise the fields are taken to be in the
+// order of the columns of the table
+func readCSV(r io.Reader) ([]record, error) {
+	cr := csv.NewReader(r)
+	// a row with the wrong number of fields
+	// is reported along with the others
+	cr.FieldsPerRecord = -1
+	names := []string{}
+	for _, c := range table.Columns {
+		names = append(names, c.Name)
+	}
+	records := []record{}
+	for first := true; ; first = false {
+		fields, err := cr.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if perr, ok := err.(*csv.ParseError); ok {
+			records = append(records, record{line: perr.StartLine, err: perr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if first && isHeader(fields) {
+			names = names[:0]
+			for _, f := range fields {
+				names = append(names, strings.ToLower(strings.TrimSpace(f)))
+			}
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+		rec := record{line: line, values: map[string]interface{}{}}
+		if len(fields) != len(names) {
+			rec.err = fmt.Errorf("expected %d values, got %d", len(names), len(fields))
+		}
+		for i, f := range fields {
+			if i < len(names) {
+				rec.values[names[i]] = f
+			}
+		}
+		records = append(records, rec)
+	}
+}
+
+// readJSONLines reads a JSON object per line,
+// keyed by column name. Blank lines are skipped
+func readJSONLines(r io.Reader) ([]record, error) {
+	scanner := bufio.NewScanner(r)
+	// room for a row of the widest strings, escaped
+	scanner.Buffer(nil, 1<<20)
+	records := []record{}
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		rec := record{line: line}
+		dec := json.NewDecoder(strings.NewReader(text))
+		// keep integers exact
+		dec.UseNumber()
+		if err := dec.Decode(&rec.values); err != nil {
+			rec.err = fmt.Errorf("not a JSON object: %s", err)
+		}
+		records = append(records, rec)
+	}
+	return records, scanner.Err()
+}
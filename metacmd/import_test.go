@@ -0,0 +1,108 @@
+package metacmd
+
+import (
+	"bytes"
+	"context"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestImport(t *testing.T) {
+	cases := []struct {
+		file    string
+		content string
+		want    string
+	}{
+		{"users.csv", "" +
+			"id,username,email\n" +
+			"1,user1,person1@example.com\n" +
+			"1,user1,person1@example.com\n" +
+			"x,user2,person2@example.com\n" +
+			"\"3\",\"user\n3\",person3@example.com\n" +
+			"4,user4\n",
+			"" +
+				"users.csv:3: duplicate key\n" +
+				"users.csv:4: id: \"x\" is not an integer\n" +
+				"users.csv:7: expected 3 values, got 2\n" +
+				"Imported 2 rows, 3 failed.\n"},
+		{"users.csv", "" +
+			"2,user2,person2@example.com\n" +
+			"1,user1,person1@example.com\n",
+			"Imported 2 rows, 0 failed.\n"},
+		{"users.jsonl", "" +
+			"{\"id\": 1, \"username\": \"user1\", \"email\": \"person1@example.com\"}\n" +
+			"{\"id\": 1.5, \"username\": \"user1\", \"email\": \"person1@example.com\"}\n" +
+			"\n" +
+			"{\"id\": 1, \"username\": \"user1\", \"email\": \"person1@example.com\"}\n" +
+			"{\"id\": 2, \"username\": \"user2\"}\n" +
+			"[1, \"user3\", \"person3@example.com\"]\n",
+			"" +
+				"users.jsonl:2: id: \"1.5\" is not an integer\n" +
+				"users.jsonl:4: duplicate key\n" +
+				"users.jsonl:5: no value for column email\n" +
+				"users.jsonl:6: not a JSON object: json: cannot unmarshal array into Go value of type map[string]interface {}\n" +
+				"Imported 1 rows, 4 failed.\n"},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		path := filepath.Join(dir, c.file)
+		if err := os.WriteFile(path, []byte(c.content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		tab, err := table.OpenDb(filepath.Join(dir, "temp.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var b bytes.Buffer
+		err = importFile(context.Background(), &b, path, table.Name, statement.NewConn(tab))
+		tab.CloseDb()
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := bytes.Replace(b.Bytes(), []byte(dir+string(filepath.Separator)), nil, -1)
+		if string(got) != c.want {
+			t.Errorf("Expected for %q:\n%q\ngot:\n%q", c.content, c.want, got)
+		}
+	}
+}
+
+func TestImportArgs(t *testing.T) {
+	cases := []struct {
+		path, table string
+		err         error
+	}{
+		{"users.csv", "people", ErrNoSuchTable},
+		{"users.txt", table.Name, ErrInvalidArgs},
+		{"missing.csv", table.Name, ErrCannotOpen},
+	}
+	for _, c := range cases {
+		var b bytes.Buffer
+		err := importFile(context.Background(), &b, filepath.Join(t.TempDir(), c.path), c.table, nil)
+		if err != c.err {
+			t.Errorf("Expected %v importing %s into %s, got %v", c.err, c.path, c.table, err)
+		}
+	}
+}
+
+func TestImportUnreadable(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "users.jsonl")
+	long := "{\"username\": \"" + strings.Repeat("a", 1<<20) + "\"}\n"
+	if err := os.WriteFile(path, []byte(long), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tab, err := table.OpenDb(filepath.Join(dir, "temp.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tab.CloseDb()
+	var b bytes.Buffer
+	err = importFile(context.Background(), &b, path, table.Name, statement.NewConn(tab))
+	if err != ErrCannotRead {
+		t.Fatalf("Expected %v for a line too long to read, got %v", ErrCannotRead, err)
+	}
+}
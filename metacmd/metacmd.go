@@ -1,27 +1,246 @@
 package metacmd
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
 	"github.com/sussadag/lets-build-a-simple-db/table"
-	"log"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 // Error Codes
 var (
 	ErrUnrecognizedCmd = errors.New("meta command not recognized")
+	ErrInvalidArgs     = errors.New("invalid arguments to meta command")
+	ErrNoSuchTable     = errors.New("no such table")
+	ErrCannotOpen      = errors.New("cannot open file")
+	ErrCannotRead      = errors.New("cannot read file")
+	ErrRestoreInTx     = errors.New("cannot restore within a transaction")
+	ErrBackupOntoDb    = errors.New("cannot back up a database onto itself")
+	ErrBadBackup       = errors.New("not a valid backup")
+	// ErrExit is returned by .exit: the shell is
+	// to close the database and stop
+	ErrExit = errors.New("exit")
 )
 
-// Execute performs the meta command in cmd
-func Execute(cmd string, t *table.Table) error {
-	switch cmd {
+// Commands lists the meta commands
+var Commands = []string{
+	".backup", ".btree", ".busy_timeout", ".check", ".dump", ".exit",
+	".headers", ".import", ".indexes", ".mode", ".nullvalue", ".page",
+	".pages", ".restore", ".schema", ".tables", ".timeout",
+}
+
+// Settings holds the state of the shell that
+// meta commands can change
+type Settings struct {
+	// Timeout is how long a statement may run
+	// before it is cancelled. Zero means no limit
+	Timeout time.Duration
+	// Mode is how results are rendered
+	Mode string
+	// Headers tells whether the names of the columns are
+	// printed above the rows. It is nil until set with
+	// .headers, and each mode then does what suits it
+	Headers *bool
+	// NullValue is printed in place of missing values
+	NullValue string
+}
+
+// NewSettings returns the settings a shell starts with
+func NewSettings() *Settings {
+	return &Settings{Mode: ModeTuple, NullValue: "NULL"}
+}
+
+// Execute performs the meta command in cmd. Commands that
+// change the data do so through c, and stop once ctx is done
+func Execute(ctx context.Context, cmd string, t *table.Table, c *statement.Conn, s *Settings) error {
+	err := execute(ctx, cmd, t, c, s)
+	switch err {
+	case table.ErrDatabaseLocked:
+		// another process is writing, or a
+		// restore has yet to be finished
+		return statement.ErrDatabaseLocked
+	case table.ErrCatalogFull:
+		return statement.ErrCatalogFull
+	case table.ErrRestored:
+		return statement.ErrRestored
+	}
+	return err
+}
+
+func execute(ctx context.Context, cmd string, t *table.Table, c *statement.Conn, s *Settings) error {
+	args := strings.Fields(cmd)
+	switch args[0] {
 	case ".exit":
-		if err := t.CloseDb(); err != nil {
-			log.Fatalf("Failed to close the database: '%s'", err)
+		return ErrExit
+	case ".timeout":
+		// .timeout MS
+		d, err := parseMillis(args)
+		if err != nil {
+			return err
+		}
+		s.Timeout = d
+	case ".busy_timeout":
+		// .busy_timeout MS
+		d, err := parseMillis(args)
+		if err != nil {
+			return err
+		}
+		t.SetBusyTimeout(d)
+	case ".mode":
+		// .mode [MODE]
+		switch {
+		case len(args) == 1:
+			fmt.Printf("current output mode: %s\n", s.Mode)
+		case len(args) == 2 && isMode(args[1]):
+			s.Mode = args[1]
+		default:
+			return ErrInvalidArgs
+		}
+	case ".headers":
+		// .headers on|off
+		if len(args) != 2 {
+			return ErrInvalidArgs
+		}
+		switch on := strings.ToLower(args[1]); on {
+		case "on", "off":
+			headers := on == "on"
+			s.Headers = &headers
+		default:
+			return ErrInvalidArgs
+		}
+	case ".nullvalue":
+		// .nullvalue [STRING]
+		switch len(args) {
+		case 1:
+			s.NullValue = ""
+		case 2:
+			s.NullValue = args[1]
+		default:
+			return ErrInvalidArgs
+		}
+	case ".import":
+		// .import FILE TABLE
+		if len(args) != 3 {
+			return ErrInvalidArgs
+		}
+		return importFile(ctx, os.Stdout, args[1], args[2], c)
+	case ".dump":
+		// .dump [TABLE]
+		if err := tableArg(args); err != nil {
+			return err
+		}
+		return dump(ctx, os.Stdout, t, c)
+	case ".tables":
+		// .tables
+		if len(args) != 1 {
+			return ErrInvalidArgs
+		}
+		fmt.Println(table.Name)
+	case ".schema":
+		// .schema [TABLE]
+		if err := tableArg(args); err != nil {
+			return err
 		}
-		os.Exit(0)
+		return schema(os.Stdout, t)
+	case ".indexes":
+		// .indexes [TABLE]
+		if err := tableArg(args); err != nil {
+			return err
+		}
+		return indexes(os.Stdout, t)
+	case ".btree":
+		// .btree [INDEX]
+		switch len(args) {
+		case 1:
+			return btree(os.Stdout, t, "")
+		case 2:
+			return btree(os.Stdout, t, args[1])
+		}
+		return ErrInvalidArgs
+	case ".pages":
+		// .pages
+		if len(args) != 1 {
+			return ErrInvalidArgs
+		}
+		return pages(os.Stdout, t, s)
+	case ".page":
+		// .page N
+		if len(args) != 2 {
+			return ErrInvalidArgs
+		}
+		num, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil {
+			return ErrInvalidArgs
+		}
+		return page(os.Stdout, t, uint(num))
+	case ".check":
+		// .check
+		if len(args) != 1 {
+			return ErrInvalidArgs
+		}
+		problems, err := t.Check()
+		if err != nil {
+			return err
+		}
+		if len(problems) == 0 {
+			problems = []string{"ok"}
+		}
+		return writeLines(os.Stdout, problems)
+	case ".backup":
+		// .backup FILE
+		if len(args) != 2 {
+			return ErrInvalidArgs
+		}
+		if err := t.Backup(ctx, args[1]); err != nil {
+			if err == table.ErrBackupOntoItself {
+				return ErrBackupOntoDb
+			}
+			// the copy is renamed over the target,
+			// which fails if that is a directory
+			switch err.(type) {
+			case *os.PathError, *os.LinkError:
+				return ErrCannotOpen
+			}
+			return err
+		}
+	case ".restore":
+		// .restore FILE
+		if len(args) != 2 {
+			return ErrInvalidArgs
+		}
+		if c.InTx() {
+			// the transaction holds on to the
+			// rows that are about to go
+			return ErrRestoreInTx
+		}
+		err := t.Restore(ctx, args[1])
+		if err == table.ErrBadBackup {
+			return ErrBadBackup
+		}
+		if _, ok := err.(*os.PathError); ok {
+			return ErrCannotOpen
+		}
+		return err
 	default:
 		return ErrUnrecognizedCmd
 	}
 	return nil
 }
+
+// parseMillis parses the single argument of a meta
+// command as a number of milliseconds
+func parseMillis(args []string) (time.Duration, error) {
+	if len(args) != 2 {
+		return 0, ErrInvalidArgs
+	}
+	ms, err := strconv.Atoi(args[1])
+	if err != nil || ms < 0 {
+		return 0, ErrInvalidArgs
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
@@ -0,0 +1,331 @@
+package metacmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// Output modes
+const (
+	// ModeTuple prints each row as (value, value, ...)
+	ModeTuple = "tuple"
+	// ModeTable prints an aligned ASCII table
+	ModeTable = "table"
+	// ModeCSV prints comma separated values as in RFC 4180
+	ModeCSV = "csv"
+	// ModeJSON prints a JSON array of objects
+	ModeJSON = "json"
+	// ModeJSONLines prints a JSON object per line
+	ModeJSONLines = "jsonl"
+	// ModeMarkdown prints a markdown table
+	ModeMarkdown = "markdown"
+	// ModeLine prints each value on a line of its own
+	ModeLine = "line"
+)
+
+var modes = []string{ModeTuple, ModeTable, ModeCSV, ModeJSON, ModeJSONLines, ModeMarkdown, ModeLine}
+
+func isMode(mode string) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+// headers reports whether the names of the columns are
+// to be printed: as set with .headers or, until then,
+// as the mode does by default
+func (s *Settings) headers(byDefault bool) bool {
+	if s.Headers == nil {
+		return byDefault
+	}
+	return *s.Headers
+}
+
+// Render writes res to w the way s asks for. A query
+// plan is written as a tree whatever the mode. Table and
+// line print the names of the columns unless headers
+// are off, tuple and csv only if they are on. Json,
+// jsonl and markdown can't do without the names, and
+// print them whatever the setting
+func Render(w io.Writer, res *statement.Result, s *Settings) error {
+	if res == nil {
+		return nil
+	}
+	if res.Plan != nil {
+		return renderPlan(w, res.Plan)
+	}
+	switch s.Mode {
+	case ModeTable:
+		return renderTable(w, res, s)
+	case ModeCSV:
+		return renderCSV(w, res, s)
+	case ModeJSON:
+		return renderJSON(w, res)
+	case ModeJSONLines:
+		return renderJSONLines(w, res)
+	case ModeMarkdown:
+		return renderMarkdown(w, res, s)
+	case ModeLine:
+		return renderLine(w, res, s)
+	}
+	return renderTuples(w, res, s)
+}
+
+func renderPlan(w io.Writer, plan []string) error {
+	lines := []string{"QUERY PLAN", "`--" + plan[0]}
+	for _, l := range plan[1:] {
+		lines = append(lines, "   "+l)
+	}
+	return writeLines(w, lines)
+}
+
+// formatValue writes v as text, with
+// the null value in place of nil
+func formatValue(v interface{}, s *Settings) string {
+	if v == nil {
+		return s.NullValue
+	}
+	return fmt.Sprint(v)
+}
+
+// formatRows writes every value of res as text
+func formatRows(res *statement.Result, s *Settings) [][]string {
+	rows := make([][]string, len(res.Rows))
+	for i, row := range res.Rows {
+		rows[i] = make([]string, len(row))
+		for j, v := range row {
+			rows[i][j] = formatValue(v, s)
+		}
+	}
+	return rows
+}
+
+func writeLines(w io.Writer, lines []string) error {
+	for _, l := range lines {
+		if _, err := io.WriteString(w, l+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func renderTuples(w io.Writer, res *statement.Result, s *Settings) error {
+	lines := []string{}
+	if s.headers(false) {
+		lines = append(lines, "("+strings.Join(res.Columns, ", ")+")")
+	}
+	for _, row := range formatRows(res, s) {
+		lines = append(lines, "("+strings.Join(row, ", ")+")")
+	}
+	return writeLines(w, lines)
+}
+
+// columnWidths returns how wide each column has to
+// be to fit its name and every one of its values
+func columnWidths(columns []string, rows [][]string) []int {
+	widths := make([]int, len(columns))
+	for i, c := range columns {
+		widths[i] = utf8.RuneCountInString(c)
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			if n := utf8.RuneCountInString(v); n > widths[i] {
+				widths[i] = n
+			}
+		}
+	}
+	return widths
+}
+
+// pad fills v with spaces up to width
+func pad(v string, width int) string {
+	return v + strings.Repeat(" ", width-utf8.RuneCountInString(v))
+}
+
+// tableRow writes the values of a row between bars
+func tableRow(values []string, widths []int) string {
+	cells := make([]string, len(values))
+	for i, v := range values {
+		cells[i] = pad(v, widths[i])
+	}
+	return "| " + strings.Join(cells, " | ") + " |"
+}
+
+// renderTable writes
+//
+//	+----+----------+
+//	| id | username |
+//	+----+----------+
+//	| 1  | user1    |
+//	+----+----------+
+//
+// leaving out the names of the columns, and
+// the rule under them, without headers
+func renderTable(w io.Writer, res *statement.Result, s *Settings) error {
+	rows := formatRows(res, s)
+	headers := s.headers(true)
+	columns := res.Columns
+	if !headers {
+		columns = make([]string, len(columns))
+	}
+	widths := columnWidths(columns, rows)
+	dashes := make([]string, len(widths))
+	for i, width := range widths {
+		dashes[i] = strings.Repeat("-", width+2)
+	}
+	rule := "+" + strings.Join(dashes, "+") + "+"
+	lines := []string{}
+	if headers {
+		lines = append(lines, rule, tableRow(columns, widths))
+	}
+	if headers || len(rows) > 0 {
+		lines = append(lines, rule)
+	}
+	for _, row := range rows {
+		lines = append(lines, tableRow(row, widths))
+	}
+	if len(rows) > 0 {
+		lines = append(lines, rule)
+	}
+	return writeLines(w, lines)
+}
+
+// renderMarkdown writes
+//
+//	| id | username |
+//	|----|----------|
+//	| 1  | user1    |
+//
+// with the bars in values escaped
+func renderMarkdown(w io.Writer, res *statement.Result, s *Settings) error {
+	rows := formatRows(res, s)
+	for _, row := range rows {
+		for i, v := range row {
+			row[i] = strings.Replace(v, "|", "\\|", -1)
+		}
+	}
+	widths := columnWidths(res.Columns, rows)
+	dashes := make([]string, len(widths))
+	for i, width := range widths {
+		dashes[i] = strings.Repeat("-", width+2)
+	}
+	lines := []string{tableRow(res.Columns, widths), "|" + strings.Join(dashes, "|") + "|"}
+	for _, row := range rows {
+		lines = append(lines, tableRow(row, widths))
+	}
+	return writeLines(w, lines)
+}
+
+func renderCSV(w io.Writer, res *statement.Result, s *Settings) error {
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if s.headers(false) {
+		if err := cw.Write(res.Columns); err != nil {
+			return err
+		}
+	}
+	if err := cw.WriteAll(formatRows(res, s)); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// jsonObject writes row as a JSON object keyed by the names
+// of the columns, in the order the columns come in
+func jsonObject(columns []string, row []interface{}) (string, error) {
+	var b bytes.Buffer
+	enc := json.NewEncoder(&b)
+	enc.SetEscapeHTML(false)
+	b.WriteString("{")
+	for i, v := range row {
+		if i > 0 {
+			b.WriteString(",")
+		}
+		if err := enc.Encode(columns[i]); err != nil {
+			return "", err
+		}
+		b.Truncate(b.Len() - 1)
+		b.WriteString(":")
+		if err := enc.Encode(v); err != nil {
+			return "", err
+		}
+		// Encode ends every value with a newline
+		b.Truncate(b.Len() - 1)
+	}
+	b.WriteString("}")
+	return b.String(), nil
+}
+
+// renderJSON writes an array with an object per row,
+// each on a line of its own
+func renderJSON(w io.Writer, res *statement.Result) error {
+	if len(res.Rows) == 0 {
+		return writeLines(w, []string{"[]"})
+	}
+	lines := []string{}
+	for i, row := range res.Rows {
+		obj, err := jsonObject(res.Columns, row)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			obj = "[" + obj
+		}
+		if i == len(res.Rows)-1 {
+			obj += "]"
+		} else {
+			obj += ","
+		}
+		lines = append(lines, obj)
+	}
+	return writeLines(w, lines)
+}
+
+func renderJSONLines(w io.Writer, res *statement.Result) error {
+	lines := []string{}
+	for _, row := range res.Rows {
+		obj, err := jsonObject(res.Columns, row)
+		if err != nil {
+			return err
+		}
+		lines = append(lines, obj)
+	}
+	return writeLines(w, lines)
+}
+
+// renderLine writes every value on a line of its own
+// after the name of its column, or alone without
+// headers, with a blank line between rows
+func renderLine(w io.Writer, res *statement.Result, s *Settings) error {
+	headers := s.headers(true)
+	width := 0
+	for _, c := range res.Columns {
+		if n := utf8.RuneCountInString(c); n > width {
+			width = n
+		}
+	}
+	lines := []string{}
+	for i, row := range formatRows(res, s) {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		for j, v := range row {
+			if !headers {
+				lines = append(lines, v)
+				continue
+			}
+			name := res.Columns[j]
+			lines = append(lines, strings.Repeat(" ", width-utf8.RuneCountInString(name))+name+" = "+v)
+		}
+	}
+	return writeLines(w, lines)
+}
@@ -0,0 +1,91 @@
+package metacmd_test
+
+import (
+	"bytes"
+	"context"
+	"github.com/sussadag/lets-build-a-simple-db/metacmd"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	res := &statement.Result{
+		Columns: []string{"id", "username"},
+		Types:   []string{"integer", "varchar(32)"},
+		Rows: [][]interface{}{
+			{int64(1), "user|1"},
+			{int64(2), nil},
+		},
+	}
+	empty := &statement.Result{
+		Columns: []string{"id"},
+		Types:   []string{"integer"},
+		Rows:    [][]interface{}{},
+	}
+	tuples := "(1, user|1)\n(2, -)\n"
+	json := "[{\"id\":1,\"username\":\"user|1\"},\n{\"id\":2,\"username\":null}]\n"
+	markdown := "" +
+		"| id | username |\n" +
+		"|----|----------|\n" +
+		"| 1  | user\\|1  |\n" +
+		"| 2  | -        |\n"
+	cases := []struct {
+		// cmds set up the mode and headers
+		cmds []string
+		res  *statement.Result
+		want string
+	}{
+		{[]string{}, res, tuples},
+		{[]string{".headers on"}, res, "(id, username)\n" + tuples},
+		{[]string{".mode table"}, res, "" +
+			"+----+----------+\n" +
+			"| id | username |\n" +
+			"+----+----------+\n" +
+			"| 1  | user|1   |\n" +
+			"| 2  | -        |\n" +
+			"+----+----------+\n"},
+		{[]string{".mode table", ".headers off"}, res, "" +
+			"+---+--------+\n" +
+			"| 1 | user|1 |\n" +
+			"| 2 | -      |\n" +
+			"+---+--------+\n"},
+		{[]string{".mode table"}, empty, "+----+\n| id |\n+----+\n"},
+		{[]string{".mode table", ".headers off"}, empty, ""},
+		{[]string{".mode csv"}, res, "1,user|1\r\n2,-\r\n"},
+		{[]string{".mode csv", ".headers on"}, res, "id,username\r\n1,user|1\r\n2,-\r\n"},
+		{[]string{".mode json"}, res, json},
+		{[]string{".mode json", ".headers off"}, res, json},
+		{[]string{".mode json"}, empty, "[]\n"},
+		{[]string{".mode jsonl", ".headers off"}, res, "{\"id\":1,\"username\":\"user|1\"}\n{\"id\":2,\"username\":null}\n"},
+		{[]string{".mode markdown"}, res, markdown},
+		{[]string{".mode markdown", ".headers off"}, res, markdown},
+		{[]string{".mode line"}, res, "      id = 1\nusername = user|1\n\n      id = 2\nusername = -\n"},
+		{[]string{".mode line", ".headers off"}, res, "1\nuser|1\n\n2\n-\n"},
+		// switching modes keeps the setting
+		{[]string{".headers off", ".mode json", ".mode tuple"}, res, tuples},
+		{[]string{".headers on", ".mode line", ".mode csv"}, res, "id,username\r\n1,user|1\r\n2,-\r\n"},
+		{[]string{".mode csv", ".headers on"}, &statement.Result{Plan: []string{"SCAN users"}}, "QUERY PLAN\n`--SCAN users\n"},
+	}
+	for _, c := range cases {
+		s := metacmd.NewSettings()
+		s.NullValue = "-"
+		for _, cmd := range c.cmds {
+			// these commands don't touch the table
+			if err := metacmd.Execute(context.Background(), cmd, nil, nil, s); err != nil {
+				t.Fatalf("Failed to run '%s': %s", cmd, err)
+			}
+		}
+		var b bytes.Buffer
+		if err := metacmd.Render(&b, c.res, s); err != nil {
+			t.Fatal(err)
+		}
+		if b.String() != c.want {
+			t.Errorf("Expected after %q:\n%q\ngot:\n%q", c.cmds, c.want, b.String())
+		}
+	}
+
+	s := metacmd.NewSettings()
+	if err := metacmd.Execute(context.Background(), ".headers maybe", nil, nil, s); err != metacmd.ErrInvalidArgs {
+		t.Fatalf("Expected %v, got %v", metacmd.ErrInvalidArgs, err)
+	}
+}
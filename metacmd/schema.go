@@ -0,0 +1,55 @@
+package metacmd
+
+import (
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"io"
+)
+
+// tableArg checks the optional table name
+// argument of a meta command
+func tableArg(args []string) error {
+	if len(args) > 2 {
+		return ErrInvalidArgs
+	}
+	if len(args) == 2 && args[1] != table.Name {
+		return ErrNoSuchTable
+	}
+	return nil
+}
+
+// schemaLines returns the statements that create the table
+// and its indexes, as recorded in the database file
+func schemaLines(t *table.Table) ([]string, error) {
+	indexes, err := t.Indexes()
+	if err != nil {
+		return nil, err
+	}
+	lines := []string{statement.CreateTable() + ";"}
+	for _, def := range indexes {
+		lines = append(lines, statement.CreateIndex(def)+";")
+	}
+	return lines, nil
+}
+
+func schema(w io.Writer, t *table.Table) error {
+	lines, err := schemaLines(t)
+	if err != nil {
+		return err
+	}
+	return writeLines(w, lines)
+}
+
+// indexes writes the names of the indexes of the
+// table, starting with its primary key
+func indexes(w io.Writer, t *table.Table) error {
+	defs, err := t.Indexes()
+	if err != nil {
+		return err
+	}
+	lines := []string{table.PrimaryKey.Name}
+	for _, def := range defs {
+		lines = append(lines, def.Name)
+	}
+	return writeLines(w, lines)
+}
@@ -0,0 +1,149 @@
+package metacmd
+
+import (
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// btree writes the B-tree of the index called name, or
+// of every index if name is empty, as a tree of nodes.
+// Entries are written as key@row and internal nodes
+// end with the ids of their children
+func btree(w io.Writer, t *table.Table, name string) error {
+	names := []string{name}
+	if name == "" {
+		defs, err := t.Indexes()
+		if err != nil {
+			return err
+		}
+		names = []string{table.PrimaryKey.Name}
+		for _, def := range defs {
+			names = append(names, def.Name)
+		}
+	}
+	lines := []string{}
+	for _, name := range names {
+		nodes, err := t.BTree(name)
+		if err == table.ErrNoSuchIndex {
+			return statement.ErrNoSuchIndex
+		}
+		if err != nil {
+			return err
+		}
+		lines = append(lines, name)
+		if len(nodes) > 0 {
+			lines = append(lines, btreeLines(nodes, 0, "`--", "   ")...)
+		}
+	}
+	return writeLines(w, lines)
+}
+
+// btreeLines writes the subtree of nodes at id, with
+// branch in front of its first line and indent in
+// front of the others
+func btreeLines(nodes []table.BTreeNode, id int, branch, indent string) []string {
+	n := nodes[id]
+	entries := make([]string, len(n.Keys))
+	for i, k := range n.Keys {
+		entries[i] = fmt.Sprintf("%s@%d", statement.Literal(k), n.Rows[i])
+	}
+	line := fmt.Sprintf("%snode %d", branch, n.Id)
+	if n.Leaf {
+		line += " leaf [" + strings.Join(entries, ", ") + "]"
+	} else {
+		children := make([]string, len(n.Children))
+		for i, c := range n.Children {
+			children[i] = strconv.Itoa(c)
+		}
+		line += " internal [" + strings.Join(entries, ", ") + "] -> " + strings.Join(children, ", ")
+	}
+	lines := []string{line}
+	for i, c := range n.Children {
+		b, in := "|--", "|  "
+		if i == len(n.Children)-1 {
+			b, in = "`--", "   "
+		}
+		lines = append(lines, btreeLines(nodes, c, indent+b, indent+in)...)
+	}
+	return lines
+}
+
+// pages writes a row per page of the database file
+// in the current mode
+func pages(w io.Writer, t *table.Table, s *Settings) error {
+	infos, err := t.Pages()
+	if err != nil {
+		return err
+	}
+	res := &statement.Result{
+		Columns: []string{"page", "type", "used", "free", "fill"},
+		Types:   []string{"integer", "varchar", "integer", "integer", "varchar"},
+		Rows:    [][]interface{}{},
+	}
+	for _, pi := range infos {
+		res.Rows = append(res.Rows, []interface{}{
+			int64(pi.Num), pi.Type, int64(pi.Used), int64(pi.Free),
+			fmt.Sprintf("%.1f%%", pi.Fill()*100),
+		})
+	}
+	return Render(w, res, s)
+}
+
+// hexdump writes b sixteen bytes a line, as offset, bytes
+// in hex and printable bytes. Runs of lines that repeat
+// the one before are written as a single *
+func hexdump(w io.Writer, b []byte) error {
+	lines := []string{}
+	prev := ""
+	squeezed := false
+	for off := 0; off < len(b); off += 16 {
+		end := off + 16
+		if end > len(b) {
+			end = len(b)
+		}
+		var hex, text strings.Builder
+		for i := off; i < off+16; i++ {
+			if i == off+8 {
+				hex.WriteString(" ")
+			}
+			if i >= end {
+				hex.WriteString("   ")
+				continue
+			}
+			fmt.Fprintf(&hex, "%02x ", b[i])
+			if b[i] >= 0x20 && b[i] < 0x7f {
+				text.WriteByte(b[i])
+			} else {
+				text.WriteByte('.')
+			}
+		}
+		body := hex.String() + " |" + text.String() + "|"
+		if body == prev && end < len(b) {
+			if !squeezed {
+				lines = append(lines, "*")
+				squeezed = true
+			}
+			continue
+		}
+		prev, squeezed = body, false
+		lines = append(lines, fmt.Sprintf("%08x  %s", off, body))
+	}
+	lines = append(lines, fmt.Sprintf("%08x", len(b)))
+	return writeLines(w, lines)
+}
+
+// page hexdumps the page num
+func page(w io.Writer, t *table.Table, num uint) error {
+	b, err := t.Page(num)
+	if err == table.ErrNoSuchPage {
+		return ErrInvalidArgs
+	}
+	if err != nil {
+		return err
+	}
+	return hexdump(w, b)
+}
@@ -0,0 +1,173 @@
+package statement
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+const (
+	tokWord = iota
+	tokNumber
+	tokString
+	tokSymbol
+)
+
+// token is a word, number, 'quoted string'
+// or single character symbol of a statement
+type token struct {
+	kind int
+	// text of the token. Strings are
+	// stored without their quotes
+	text string
+}
+
+// lex splits cmd into tokens. Comments, from -- to the end
+// of the line or from /* to */, are left out
+func lex(cmd string) ([]token, error) {
+	toks := []token{}
+	rs := []rune(cmd)
+	for i := 0; i < len(rs); {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '-' && i+1 < len(rs) && rs[i+1] == '-':
+			// comments are skipped like spaces
+			for i < len(rs) && rs[i] != '\n' {
+				i++
+			}
+		case r == '/' && i+1 < len(rs) && rs[i+1] == '*':
+			i += 2
+			for !(i+1 < len(rs) && rs[i] == '*' && rs[i+1] == '/') {
+				if i >= len(rs) {
+					return nil, ErrSyntaxError
+				}
+				i++
+			}
+			i += 2
+		case r == '\'':
+			// quotes inside a string are doubled: 'it''s'
+			var b strings.Builder
+			i++
+			for {
+				if i >= len(rs) {
+					return nil, ErrSyntaxError
+				}
+				if rs[i] == '\'' {
+					if i+1 < len(rs) && rs[i+1] == '\'' {
+						b.WriteRune('\'')
+						i += 2
+						continue
+					}
+					i++
+					break
+				}
+				b.WriteRune(rs[i])
+				i++
+			}
+			toks = append(toks, token{kind: tokString, text: b.String()})
+		case unicode.IsDigit(r) || (r == '-' && i+1 < len(rs) && unicode.IsDigit(rs[i+1])):
+			j := i + 1
+			for j < len(rs) && unicode.IsDigit(rs[j]) {
+				j++
+			}
+			toks = append(toks, token{kind: tokNumber, text: string(rs[i:j])})
+			i = j
+		case unicode.IsLetter(r) || r == '_':
+			j := i + 1
+			for j < len(rs) && (unicode.IsLetter(rs[j]) || unicode.IsDigit(rs[j]) || rs[j] == '_') {
+				j++
+			}
+			toks = append(toks, token{kind: tokWord, text: string(rs[i:j])})
+			i = j
+		default:
+			toks = append(toks, token{kind: tokSymbol, text: string(r)})
+			i++
+		}
+	}
+	return toks, nil
+}
+
+// parser walks the tokens of a statement
+type parser struct {
+	toks []token
+	pos  int
+}
+
+func newParser(cmd string) (*parser, error) {
+	toks, err := lex(cmd)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{toks: toks}, nil
+}
+
+// peek returns the next token, which has
+// an empty text at the end of the statement
+func (p *parser) peek() token {
+	if p.pos >= len(p.toks) {
+		return token{kind: tokSymbol}
+	}
+	return p.toks[p.pos]
+}
+
+// accept consumes the next token if it is the
+// keyword or symbol s. Keywords are case insensitive
+func (p *parser) accept(s string) bool {
+	tok := p.peek()
+	if tok.kind != tokWord && tok.kind != tokSymbol {
+		return false
+	}
+	if !strings.EqualFold(tok.text, s) {
+		return false
+	}
+	p.pos++
+	return true
+}
+
+// expect consumes the keyword or symbol s,
+// which must come next
+func (p *parser) expect(s string) error {
+	if !p.accept(s) {
+		return ErrSyntaxError
+	}
+	return nil
+}
+
+// ident consumes a name
+func (p *parser) ident() (string, error) {
+	tok := p.peek()
+	if tok.kind != tokWord {
+		return "", ErrSyntaxError
+	}
+	p.pos++
+	return tok.text, nil
+}
+
+// literal consumes a number, which is returned
+// as an int64, or a string
+func (p *parser) literal() (interface{}, error) {
+	tok := p.peek()
+	switch tok.kind {
+	case tokNumber:
+		n, err := strconv.ParseInt(tok.text, 10, 64)
+		if err != nil {
+			return nil, ErrSyntaxError
+		}
+		p.pos++
+		return n, nil
+	case tokString:
+		p.pos++
+		return tok.text, nil
+	}
+	return nil, ErrSyntaxError
+}
+
+// end checks that every token was consumed
+func (p *parser) end() error {
+	if p.pos < len(p.toks) {
+		return ErrSyntaxError
+	}
+	return nil
+}
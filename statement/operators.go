@@ -0,0 +1,320 @@
+package statement
+
+import (
+	"context"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"sort"
+	"strings"
+)
+
+// scanOp reads every row of the table in insertion order
+type scanOp struct {
+	c *table.Cursor
+}
+
+func (s *scanOp) open(ctx context.Context, conn *Conn) error {
+	s.c = conn.cursor(ctx)
+	return nil
+}
+
+func (s *scanOp) next() (tuple, bool, error) {
+	if s.c.Next() {
+		return rowTuple(s.c.Row()), true, nil
+	}
+	return nil, false, s.c.Err()
+}
+
+func (s *scanOp) close() error            { return s.c.Close() }
+func (s *scanOp) columns() []table.Column { return table.Columns }
+func (s *scanOp) inputs() []*planNode     { return nil }
+func (s *scanOp) explain() string         { return "SCAN " + table.Name }
+func (s *scanOp) pagesRead() int          { return s.c.PagesRead() }
+
+// indexScanOp reads the rows that satisfy
+// cond through an index on its column
+type indexScanOp struct {
+	index table.IndexDef
+	cond  condition
+	c     *table.Cursor
+}
+
+func (s *indexScanOp) open(ctx context.Context, conn *Conn) error {
+	s.c = conn.indexScan(ctx, s.index.Name, s.cond.lo, s.cond.hi)
+	return nil
+}
+
+func (s *indexScanOp) next() (tuple, bool, error) {
+	if s.c.Next() {
+		return rowTuple(s.c.Row()), true, nil
+	}
+	return nil, false, s.c.Err()
+}
+
+func (s *indexScanOp) close() error            { return s.c.Close() }
+func (s *indexScanOp) columns() []table.Column { return table.Columns }
+func (s *indexScanOp) inputs() []*planNode     { return nil }
+func (s *indexScanOp) pagesRead() int          { return s.c.PagesRead() }
+
+func (s *indexScanOp) explain() string {
+	return fmt.Sprintf("SEARCH %s USING INDEX %s (%s)", table.Name, s.index.Name, s.cond)
+}
+
+// filterOp passes on the tuples of its
+// input that satisfy cond
+type filterOp struct {
+	input *planNode
+	cond  condition
+	// col is the position of the
+	// column of cond in the tuples
+	col int
+}
+
+func (f *filterOp) open(ctx context.Context, conn *Conn) error {
+	f.col = columnIndex(f.input.columns(), f.cond.column)
+	return f.input.open(ctx, conn)
+}
+
+func (f *filterOp) next() (tuple, bool, error) {
+	for {
+		t, ok, err := f.input.next()
+		if !ok || err != nil {
+			return t, ok, err
+		}
+		if f.cond.matches(t[f.col]) {
+			return t, true, nil
+		}
+	}
+}
+
+func (f *filterOp) close() error            { return f.input.close() }
+func (f *filterOp) columns() []table.Column { return f.input.columns() }
+func (f *filterOp) inputs() []*planNode     { return []*planNode{f.input} }
+func (f *filterOp) explain() string         { return "FILTER " + f.cond.String() }
+
+// projectOp passes on the columns called names
+// of the tuples of its input
+type projectOp struct {
+	input *planNode
+	names []string
+	// cols are the positions of names in the input
+	cols []int
+}
+
+func (p *projectOp) open(ctx context.Context, conn *Conn) error {
+	p.cols = nil
+	for _, name := range p.names {
+		p.cols = append(p.cols, columnIndex(p.input.columns(), name))
+	}
+	return p.input.open(ctx, conn)
+}
+
+func (p *projectOp) next() (tuple, bool, error) {
+	t, ok, err := p.input.next()
+	if !ok || err != nil {
+		return nil, ok, err
+	}
+	projected := make(tuple, len(p.cols))
+	for i, col := range p.cols {
+		projected[i] = t[col]
+	}
+	return projected, true, nil
+}
+
+func (p *projectOp) close() error        { return p.input.close() }
+func (p *projectOp) inputs() []*planNode { return []*planNode{p.input} }
+func (p *projectOp) explain() string     { return "PROJECT " + strings.Join(p.names, ", ") }
+
+func (p *projectOp) columns() []table.Column {
+	input := p.input.columns()
+	columns := []table.Column{}
+	for _, name := range p.names {
+		columns = append(columns, input[columnIndex(input, name)])
+	}
+	return columns
+}
+
+// sortOp passes on the tuples of its input ordered by
+// column. It has to read all of them before handing
+// out the first one
+type sortOp struct {
+	input  *planNode
+	column string
+	desc   bool
+
+	sorted []tuple
+}
+
+func (s *sortOp) open(ctx context.Context, conn *Conn) error {
+	if err := s.input.open(ctx, conn); err != nil {
+		return err
+	}
+	col := columnIndex(s.input.columns(), s.column)
+	s.sorted = nil
+	for {
+		t, ok, err := s.input.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		s.sorted = append(s.sorted, t)
+	}
+	// stable, so that ties keep the order they came in
+	sort.SliceStable(s.sorted, func(i, j int) bool {
+		c := compareValues(s.sorted[i][col], s.sorted[j][col])
+		if s.desc {
+			return c > 0
+		}
+		return c < 0
+	})
+	return nil
+}
+
+func (s *sortOp) next() (tuple, bool, error) {
+	if len(s.sorted) == 0 {
+		return nil, false, nil
+	}
+	t := s.sorted[0]
+	s.sorted = s.sorted[1:]
+	return t, true, nil
+}
+
+func (s *sortOp) close() error            { return s.input.close() }
+func (s *sortOp) columns() []table.Column { return s.input.columns() }
+func (s *sortOp) inputs() []*planNode     { return []*planNode{s.input} }
+
+func (s *sortOp) explain() string {
+	if s.desc {
+		return "SORT BY " + s.column + " DESC"
+	}
+	return "SORT BY " + s.column
+}
+
+// limitOp passes on the first limit
+// tuples of its input
+type limitOp struct {
+	input *planNode
+	limit int64
+
+	seen int64
+}
+
+func (l *limitOp) open(ctx context.Context, conn *Conn) error {
+	l.seen = 0
+	return l.input.open(ctx, conn)
+}
+
+func (l *limitOp) next() (tuple, bool, error) {
+	if l.seen >= l.limit {
+		// stop pulling from the input altogether
+		return nil, false, nil
+	}
+	t, ok, err := l.input.next()
+	if ok {
+		l.seen += 1
+	}
+	return t, ok, err
+}
+
+func (l *limitOp) close() error            { return l.input.close() }
+func (l *limitOp) columns() []table.Column { return l.input.columns() }
+func (l *limitOp) inputs() []*planNode     { return []*planNode{l.input} }
+func (l *limitOp) explain() string         { return fmt.Sprintf("LIMIT %d", l.limit) }
+
+// aggregate is an aggregate function
+// over a column, or over rows for count(*)
+type aggregate struct {
+	fn string
+	// column is empty for count(*)
+	column string
+}
+
+func (a aggregate) String() string {
+	if a.column == "" {
+		return a.fn + "(*)"
+	}
+	return a.fn + "(" + a.column + ")"
+}
+
+// aggregateOp reads every tuple of its input and hands
+// out a single one holding the value of each aggregate
+type aggregateOp struct {
+	input      *planNode
+	aggregates []aggregate
+
+	done bool
+}
+
+func (a *aggregateOp) open(ctx context.Context, conn *Conn) error {
+	a.done = false
+	return a.input.open(ctx, conn)
+}
+
+func (a *aggregateOp) next() (tuple, bool, error) {
+	if a.done {
+		return nil, false, nil
+	}
+	a.done = true
+	cols := make([]int, len(a.aggregates))
+	for i, agg := range a.aggregates {
+		cols[i] = columnIndex(a.input.columns(), agg.column)
+	}
+	result := make(tuple, len(a.aggregates))
+	for i, agg := range a.aggregates {
+		if agg.fn == "count" {
+			result[i] = int64(0)
+		}
+	}
+	for {
+		t, ok, err := a.input.next()
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return result, true, nil
+		}
+		for i, agg := range a.aggregates {
+			switch agg.fn {
+			case "count":
+				result[i] = result[i].(int64) + 1
+			case "min":
+				if result[i] == nil || compareValues(t[cols[i]], result[i]) < 0 {
+					result[i] = t[cols[i]]
+				}
+			case "max":
+				if result[i] == nil || compareValues(t[cols[i]], result[i]) > 0 {
+					result[i] = t[cols[i]]
+				}
+			}
+		}
+	}
+}
+
+func (a *aggregateOp) close() error        { return a.input.close() }
+func (a *aggregateOp) inputs() []*planNode { return []*planNode{a.input} }
+
+// columns are named after the aggregates. count is an
+// integer, while min and max are of the type of their
+// column
+func (a *aggregateOp) columns() []table.Column {
+	columns := []table.Column{}
+	for _, agg := range a.aggregates {
+		c := table.Column{Name: agg.String(), Type: "integer"}
+		if agg.fn != "count" {
+			input := a.input.columns()
+			c.Type = input[columnIndex(input, agg.column)].Type
+		}
+		columns = append(columns, c)
+	}
+	return columns
+}
+
+func (a *aggregateOp) explain() string {
+	names := []string{}
+	for _, agg := range a.aggregates {
+		names = append(names, agg.String())
+	}
+	return "AGGREGATE " + strings.Join(names, ", ")
+}
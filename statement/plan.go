@@ -0,0 +1,250 @@
+package statement
+
+import (
+	"context"
+	"fmt"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"math"
+	"strings"
+	"time"
+)
+
+// tuple is a row as it flows through a query plan: the
+// values of the columns of the operator that produced it.
+// Values are int64s, strings, or nil when there is none
+type tuple []interface{}
+
+// rowTuple returns the values of the columns of r
+func rowTuple(r table.Row) tuple {
+	t := make(tuple, len(table.Columns))
+	for i, c := range table.Columns {
+		t[i], _ = r.Value(c.Name)
+	}
+	return t
+}
+
+// columnIndex returns the position of the column
+// called name in columns, or -1 if it isn't there
+func columnIndex(columns []table.Column, name string) int {
+	for i, c := range columns {
+		if c.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// compareValues returns -1, 0 or 1 as a sorts before,
+// with or after b. nil sorts before everything else
+func compareValues(a, b interface{}) int {
+	switch {
+	case a == nil && b == nil:
+		return 0
+	case a == nil:
+		return -1
+	case b == nil:
+		return 1
+	}
+	switch a := a.(type) {
+	case int64:
+		b := b.(int64)
+		if a < b {
+			return -1
+		} else if a > b {
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	}
+	return 0
+}
+
+// condition restricts the rows of a query to those
+// whose column holds a value from lo to hi
+type condition struct {
+	column string
+	lo, hi interface{}
+}
+
+func (c condition) String() string {
+	if c.lo == c.hi {
+		return fmt.Sprintf("%s = %s", c.column, Literal(c.lo))
+	}
+	return fmt.Sprintf("%s BETWEEN %s AND %s", c.column, Literal(c.lo), Literal(c.hi))
+}
+
+// matches reports whether v satisfies c
+func (c condition) matches(v interface{}) bool {
+	return compareValues(c.lo, v) <= 0 && compareValues(v, c.hi) <= 0
+}
+
+// Literal writes v the way it is written in sql
+func Literal(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return "NULL"
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	}
+	return fmt.Sprint(v)
+}
+
+// operator is a step of a query plan. An operator is
+// opened, then hands out its tuples one at a time, pulling
+// them from its inputs as it goes, and is finally closed.
+// New kinds of queries are answered by putting operators
+// together
+type operator interface {
+	open(ctx context.Context, c *Conn) error
+	next() (tuple, bool, error)
+	close() error
+	// columns describes the values of the tuples
+	columns() []table.Column
+	// inputs are the nodes the operator reads from
+	inputs() []*planNode
+	// explain describes the operator in a line
+	explain() string
+}
+
+// pageReader is implemented by the operators
+// that read rows off the pages of the table
+type pageReader interface {
+	pagesRead() int
+}
+
+// planNode is an operator of a query plan along with what
+// explain analyze reports about it. The time spent in an
+// operator includes the time spent in its inputs
+type planNode struct {
+	op      operator
+	rows    int
+	elapsed time.Duration
+}
+
+func (n *planNode) open(ctx context.Context, c *Conn) error {
+	start := time.Now()
+	defer func() { n.elapsed += time.Since(start) }()
+	return n.op.open(ctx, c)
+}
+
+func (n *planNode) next() (tuple, bool, error) {
+	start := time.Now()
+	defer func() { n.elapsed += time.Since(start) }()
+	t, ok, err := n.op.next()
+	if ok {
+		n.rows += 1
+	}
+	return t, ok, err
+}
+
+func (n *planNode) close() error {
+	return n.op.close()
+}
+
+func (n *planNode) columns() []table.Column {
+	return n.op.columns()
+}
+
+// run runs the plan at n, handing each tuple to emit
+func (n *planNode) run(ctx context.Context, c *Conn, emit func(tuple)) error {
+	if err := n.open(ctx, c); err != nil {
+		return err
+	}
+	defer n.close()
+	for {
+		t, ok, err := n.next()
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return nil
+		}
+		emit(t)
+	}
+}
+
+// explain writes the plan at n as a tree, one operator
+// per line. With analyze, each line also tells what
+// happened when the plan ran
+func (n *planNode) explain(analyze bool) []string {
+	line := n.op.explain()
+	if analyze {
+		line += fmt.Sprintf(" (rows=%d", n.rows)
+		if pr, ok := n.op.(pageReader); ok {
+			line += fmt.Sprintf(" pages=%d", pr.pagesRead())
+		}
+		line += fmt.Sprintf(" time=%.3fms)", float64(n.elapsed)/float64(time.Millisecond))
+	}
+	lines := []string{line}
+	inputs := n.op.inputs()
+	for i, in := range inputs {
+		branch, indent := "|--", "|  "
+		if i == len(inputs)-1 {
+			branch, indent = "`--", "   "
+		}
+		for j, l := range in.explain(analyze) {
+			if j == 0 {
+				lines = append(lines, branch+l)
+			} else {
+				lines = append(lines, indent+l)
+			}
+		}
+	}
+	return lines
+}
+
+// planSelect builds the plan of s: the rows are found,
+// then aggregated, sorted, cut short and projected, in
+// that order, as the statement asks
+func planSelect(s *selectStatement, indexes []table.IndexDef, stats *table.Stats) *planNode {
+	plan := planAccess(s.where, indexes, stats)
+	if len(s.aggregates) > 0 {
+		plan = &planNode{op: &aggregateOp{input: plan, aggregates: s.aggregates}}
+	}
+	if s.orderBy != "" {
+		plan = &planNode{op: &sortOp{input: plan, column: s.orderBy, desc: s.desc}}
+	}
+	if s.limit >= 0 {
+		plan = &planNode{op: &limitOp{input: plan, limit: s.limit}}
+	}
+	if s.columns != nil {
+		plan = &planNode{op: &projectOp{input: plan, names: s.columns}}
+	}
+	return plan
+}
+
+// planAccess builds the plan that finds the rows satisfying
+// where. A condition is answered either by filtering every
+// row or through an index on its column. Given stats, the
+// cheaper of the two is picked: a scan reads every page
+// once, while going through an index may read a page for
+// every row it finds. Without stats, an index is always
+// used when there is one
+func planAccess(where *condition, indexes []table.IndexDef, stats *table.Stats) *planNode {
+	if where == nil {
+		return &planNode{op: &scanOp{}}
+	}
+	plan := &planNode{op: &filterOp{
+		input: &planNode{op: &scanOp{}},
+		cond:  *where,
+	}}
+	cost := math.Inf(1)
+	if stats != nil {
+		cost = stats.Pages()
+	}
+	indexes = append([]table.IndexDef{table.PrimaryKey}, indexes...)
+	for _, idx := range indexes {
+		if idx.Column != where.column {
+			continue
+		}
+		indexCost := 0.0
+		if stats != nil {
+			indexCost = stats.Estimate(where.column, where.lo, where.hi)
+		}
+		if indexCost < cost {
+			plan = &planNode{op: &indexScanOp{index: idx, cond: *where}}
+			cost = indexCost
+		}
+	}
+	return plan
+}
@@ -0,0 +1,116 @@
+package statement
+
+import (
+	"strings"
+	"unicode"
+)
+
+// states of a Splitter, in between two runes
+const (
+	splitCode = iota
+	splitString
+	splitLineComment
+	splitBlockComment
+)
+
+// Splitter splits input, fed to it in pieces such as
+// the lines typed in, into statements that end at a
+// ';'. A ';' inside a 'quoted string' or a comment
+// doesn't end a statement. Comments, which run from
+// -- to the end of the line or from /* to */, are
+// left out of the statements.
+//
+// A comment only starts a word: a -- or /* right after
+// other text, as in the legacy insert 1 a--b x@y, is
+// part of that text
+type Splitter struct {
+	state int
+	// stmt is the statement read so far
+	stmt strings.Builder
+	// prev is the rune before the current one,
+	// or 0 at the start of a statement
+	prev rune
+}
+
+// Feed reads text, and returns the statements it
+// completes, without their ';'. Empty statements
+// are left out
+func (sp *Splitter) Feed(text string) []string {
+	stmts := []string{}
+	rs := []rune(text)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		next := rune(0)
+		if i+1 < len(rs) {
+			next = rs[i+1]
+		}
+		prev := sp.prev
+		sp.prev = r
+		switch sp.state {
+		case splitString:
+			// a doubled quote is a quote in the string, and
+			// takes the string in and out again
+			if r == '\'' {
+				sp.state = splitCode
+			}
+			sp.stmt.WriteRune(r)
+		case splitLineComment:
+			if r == '\n' {
+				sp.state = splitCode
+				sp.stmt.WriteRune(r)
+			}
+		case splitBlockComment:
+			if r == '*' && next == '/' {
+				sp.state = splitCode
+				// the comment stands in for a space
+				sp.prev = ' '
+				i++
+			}
+		default:
+			switch {
+			case r == '\'':
+				sp.state = splitString
+				sp.stmt.WriteRune(r)
+			case r == '-' && next == '-' && startsWord(prev):
+				sp.state = splitLineComment
+				// keep the words around it apart
+				sp.stmt.WriteRune(' ')
+				i++
+			case r == '/' && next == '*' && startsWord(prev):
+				sp.state = splitBlockComment
+				sp.stmt.WriteRune(' ')
+				i++
+			case r == ';':
+				if stmt := sp.Flush(); stmt != "" {
+					stmts = append(stmts, stmt)
+				}
+			default:
+				sp.stmt.WriteRune(r)
+			}
+		}
+	}
+	return stmts
+}
+
+// startsWord reports whether a rune that
+// comes after prev is at the start of a word
+func startsWord(prev rune) bool {
+	return prev == 0 || unicode.IsSpace(prev)
+}
+
+// Pending reports whether a statement, string or
+// block comment was started and not ended yet
+func (sp *Splitter) Pending() bool {
+	return sp.state == splitString || sp.state == splitBlockComment ||
+		strings.TrimSpace(sp.stmt.String()) != ""
+}
+
+// Flush returns the statement read so far, even
+// though it didn't end, and starts over
+func (sp *Splitter) Flush() string {
+	stmt := strings.TrimSpace(sp.stmt.String())
+	sp.stmt.Reset()
+	sp.state = splitCode
+	sp.prev = 0
+	return stmt
+}
@@ -1,6 +1,7 @@
 package statement
 
 import (
+	"context"
 	"errors"
 	"github.com/sussadag/lets-build-a-simple-db/table"
 	"strings"
@@ -11,6 +12,9 @@ var (
 	ErrUnrecognizedStatement = errors.New("statement not recognized")
 	ErrSyntaxError           = errors.New("syntax error. Could not parse statement")
 	ErrTableFull             = errors.New("table full")
+	ErrDatabaseLocked        = errors.New("database is locked")
+	ErrCatalogFull           = errors.New("catalog is full")
+	ErrRestored              = errors.New("database was restored while being read")
 )
 
 const (
@@ -19,7 +23,105 @@ const (
 )
 
 type statement interface {
-	Execute(*table.Table) error
+	Execute(context.Context, *Conn) (*Result, error)
+}
+
+// Result is what executing a statement gives back. Queries
+// fill in Columns, Types and Rows. Explain fills in Plan.
+// Other statements return no Result at all
+type Result struct {
+	// Columns are the names of the columns
+	Columns []string
+	// Types are the types of the columns, as in sql
+	Types []string
+	// Rows hold a value per column: an int64, a
+	// string, or nil when there is no value
+	Rows [][]interface{}
+	// Plan is a query plan, one line per operator
+	Plan []string
+}
+
+// Conn is a session with the database. It keeps
+// track of the transaction opened with 'begin'
+type Conn struct {
+	t *table.Table
+	// tx is nil outside of a transaction, in
+	// which case every statement autocommits
+	tx *table.Tx
+}
+
+// NewConn opens a session on t
+func NewConn(t *table.Table) *Conn {
+	return &Conn{t: t}
+}
+
+// InTx reports whether a transaction is active
+func (c *Conn) InTx() bool {
+	return c.tx != nil
+}
+
+// insert inserts r in the current transaction, if any
+func (c *Conn) insert(ctx context.Context, r table.Row) error {
+	if c.tx != nil {
+		return c.tx.Insert(ctx, r)
+	}
+	return c.t.Insert(ctx, r)
+}
+
+// cursor returns a cursor that sees the changes
+// made in the current transaction, if any
+func (c *Conn) cursor(ctx context.Context) *table.Cursor {
+	if c.tx != nil {
+		return c.tx.Cursor(ctx)
+	}
+	return c.t.Cursor(ctx)
+}
+
+// indexScan returns a cursor over the rows whose key in
+// the index called name is from lo to hi, seeing the
+// changes made in the current transaction
+func (c *Conn) indexScan(ctx context.Context, name string, lo, hi interface{}) *table.Cursor {
+	if c.tx != nil {
+		return c.tx.IndexScan(ctx, name, lo, hi)
+	}
+	return c.t.IndexScan(ctx, name, lo, hi)
+}
+
+// reading runs fn within the current transaction or, outside
+// of one, within a transaction that only reads. The plan of a
+// query and the rows it reads then come from one snapshot, so
+// an index dropped in between by another process goes unseen
+func (c *Conn) reading(fn func() error) error {
+	if c.tx != nil {
+		return fn()
+	}
+	tx, err := c.t.Begin()
+	if err != nil {
+		return err
+	}
+	c.tx = tx
+	defer func() {
+		c.tx = nil
+		tx.Rollback()
+	}()
+	return fn()
+}
+
+// plan builds the plan of s out of the indexes and stats
+// the current transaction sees. It must be called from
+// within reading
+func (c *Conn) plan(s *selectStatement) *planNode {
+	return planSelect(s, c.tx.Indexes(), c.tx.Stats())
+}
+
+// Keywords lists the words statements are made of
+var Keywords = []string{
+	"analyze", "and", "asc", "begin", "between", "by", "commit", "count",
+	"create", "desc", "drop", "end", "exists", "explain", "from", "if",
+	"index", "insert", "integer", "integrity_check", "into", "limit",
+	"max", "min", "not", "on", "order", "pragma", "release", "rollback",
+	"savepoint", "select", "table", "to", "transaction", "unique",
+	"values", "varchar", "where",
 }
 
 // Prepare parses the sql cmd query into
@@ -29,11 +131,38 @@ func Prepare(cmd string, t *table.Table) (s statement, err error) {
 		return prepareSelect(cmd)
 	} else if strings.HasPrefix(cmd, "insert") {
 		return prepareInsert(cmd)
+	} else if strings.HasPrefix(cmd, "create") {
+		if fields := strings.Fields(cmd); len(fields) > 1 && strings.EqualFold(fields[1], "table") {
+			return prepareCreateTable(cmd)
+		}
+		return prepareCreateIndex(cmd)
+	} else if strings.HasPrefix(cmd, "drop") {
+		return prepareDropIndex(cmd)
+	} else if strings.HasPrefix(cmd, "explain") {
+		return prepareExplain(cmd)
+	} else if strings.HasPrefix(cmd, "analyze") {
+		return prepareAnalyze(cmd)
+	} else if strings.HasPrefix(cmd, "pragma") {
+		return preparePragma(cmd)
+	} else if isTxStatement(cmd) {
+		return prepareTx(cmd)
 	}
 	return nil, ErrUnrecognizedStatement
 }
 
-// Execute the returned statement s
-func Execute(s statement, t *table.Table) error {
-	return s.Execute(t)
+// Execute the returned statement s. Execution
+// stops with ctx's error once ctx is done
+func Execute(ctx context.Context, s statement, c *Conn) (*Result, error) {
+	res, err := s.Execute(ctx, c)
+	switch err {
+	case table.ErrDatabaseLocked:
+		return nil, ErrDatabaseLocked
+	case table.ErrCatalogFull:
+		// the indexes or the statistics of
+		// analyze have grown too many
+		return nil, ErrCatalogFull
+	case table.ErrRestored:
+		return nil, ErrRestored
+	}
+	return res, err
 }
@@ -0,0 +1,52 @@
+package statement
+
+import (
+	"context"
+	"strings"
+)
+
+type explainStatement struct {
+	query *selectStatement
+	// analyze runs the query as well
+	analyze bool
+}
+
+// prepareExplain parses
+//
+//	explain [analyze] query
+func prepareExplain(cmd string) (*explainStatement, error) {
+	s := &explainStatement{}
+	rest := strings.TrimSpace(strings.TrimPrefix(cmd, "explain"))
+	if fields := strings.Fields(rest); len(fields) > 0 && fields[0] == "analyze" {
+		s.analyze = true
+		rest = strings.TrimSpace(strings.TrimPrefix(rest, "analyze"))
+	}
+	if !strings.HasPrefix(rest, "select") {
+		return nil, ErrSyntaxError
+	}
+	query, err := prepareSelect(rest)
+	if err != nil {
+		return nil, err
+	}
+	s.query = query
+	return s, nil
+}
+
+func (s *explainStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	res := &Result{}
+	err := c.reading(func() error {
+		plan := c.plan(s.query)
+		if s.analyze {
+			// the rows themselves are not returned
+			if err := plan.run(ctx, c, func(tuple) {}); err != nil {
+				return err
+			}
+		}
+		res.Plan = plan.explain(s.analyze)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,181 @@
+package statement
+
+import (
+	"context"
+	"errors"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+)
+
+// index specific errors
+var (
+	ErrNoSuchTable  = errors.New("no such table")
+	ErrNoSuchColumn = errors.New("no such column")
+	ErrIndexExists  = errors.New("index already exists")
+	ErrNoSuchIndex  = errors.New("no such index")
+	ErrSchemaInTx   = errors.New("cannot change the schema within a transaction")
+	ErrTypeMismatch = errors.New("value does not match the type of the column")
+)
+
+type createIndexStatement struct {
+	def table.IndexDef
+}
+
+// prepareCreateIndex parses
+//
+//	create [unique] index [name] on users(column)
+//
+// The index is called users_<column>_idx
+// if no name is given
+func prepareCreateIndex(cmd string) (*createIndexStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s := &createIndexStatement{}
+	if err := p.expect("create"); err != nil {
+		return nil, err
+	}
+	s.def.Unique = p.accept("unique")
+	if err := p.expect("index"); err != nil {
+		return nil, err
+	}
+	if !p.accept("on") {
+		if s.def.Name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if err := p.expect("on"); err != nil {
+			return nil, err
+		}
+	}
+	if err := parseTableName(p); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	if s.def.Column, err = parseColumn(p); err != nil {
+		return nil, err
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	if s.def.Name == "" {
+		s.def.Name = table.Name + "_" + s.def.Column + "_idx"
+	}
+	return s, nil
+}
+
+func (s *createIndexStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	if c.tx != nil {
+		return nil, ErrSchemaInTx
+	}
+	return nil, indexErr(c.t.CreateIndex(ctx, s.def))
+}
+
+type dropIndexStatement struct {
+	name string
+}
+
+// prepareDropIndex parses
+//
+//	drop index name
+func prepareDropIndex(cmd string) (*dropIndexStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s := &dropIndexStatement{}
+	if err := p.expect("drop"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("index"); err != nil {
+		return nil, err
+	}
+	if s.name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *dropIndexStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	if c.tx != nil {
+		return nil, ErrSchemaInTx
+	}
+	return nil, indexErr(c.t.DropIndex(ctx, s.name))
+}
+
+type analyzeStatement struct {
+}
+
+// prepareAnalyze parses
+//
+//	analyze [users]
+func prepareAnalyze(cmd string) (*analyzeStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("analyze"); err != nil {
+		return nil, err
+	}
+	if p.end() != nil {
+		if err := parseTableName(p); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return &analyzeStatement{}, nil
+}
+
+func (s *analyzeStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	if c.tx != nil {
+		return nil, ErrSchemaInTx
+	}
+	return nil, c.t.Analyze(ctx)
+}
+
+// parseTableName consumes the name of the table,
+// which has to be the only one there is
+func parseTableName(p *parser) error {
+	name, err := p.ident()
+	if err != nil {
+		return err
+	}
+	if name != table.Name {
+		return ErrNoSuchTable
+	}
+	return nil
+}
+
+// parseColumn consumes the name of a column of the table
+func parseColumn(p *parser) (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	if !table.IsColumn(name) {
+		return "", ErrNoSuchColumn
+	}
+	return name, nil
+}
+
+// indexErr translates the table's index errors
+func indexErr(err error) error {
+	switch err {
+	case table.ErrIndexExists:
+		return ErrIndexExists
+	case table.ErrNoSuchIndex:
+		return ErrNoSuchIndex
+	case table.ErrDuplicateKey:
+		return ErrDuplicateKey
+	}
+	return err
+}
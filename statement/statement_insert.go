@@ -1,6 +1,7 @@
 package statement
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"github.com/sussadag/lets-build-a-simple-db/table"
@@ -11,13 +12,24 @@ import (
 var (
 	ErrStringTooLong = errors.New("string too long")
 	ErrNegativeId    = errors.New("negative id")
+	ErrDuplicateKey  = errors.New("duplicate key")
 )
 
 type insertStatement struct {
 	r table.Row
 }
 
+// prepareInsert parses
+//
+//	insert id username email
+//	insert into users [(column, ...)] values (value, ...)
+//
+// The second form takes quoted strings, so
+// that they may hold spaces
 func prepareInsert(cmd string) (*insertStatement, error) {
+	if fields := strings.Fields(cmd); len(fields) > 1 && strings.EqualFold(fields[1], "into") {
+		return prepareInsertInto(cmd)
+	}
 	s := insertStatement{}
 	var tmp, user, email string
 	n, err := fmt.Fscanln(
@@ -33,22 +45,157 @@ func prepareInsert(cmd string) (*insertStatement, error) {
 	if n != 4 {
 		return nil, ErrSyntaxError
 	}
-	if len(user) > len(s.r.Username) || len(email) > len(s.r.Email) {
-		return nil, ErrStringTooLong
+	s.r, err = NewRow(s.r.Id, user, email)
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+func prepareInsertInto(cmd string) (*insertStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("insert"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("into"); err != nil {
+		return nil, err
+	}
+	if err := parseTableName(p); err != nil {
+		return nil, err
+	}
+	columns := []string{}
+	if p.accept("(") {
+		for {
+			column, err := parseColumn(p)
+			if err != nil {
+				return nil, err
+			}
+			columns = append(columns, column)
+			if !p.accept(",") {
+				break
+			}
+		}
+		if err := p.expect(")"); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, c := range table.Columns {
+			columns = append(columns, c.Name)
+		}
+	}
+	if err := p.expect("values"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	values := map[string]interface{}{}
+	for i, column := range columns {
+		if i > 0 {
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+		}
+		if values[column], err = parseValue(p, column); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	// every column has to be given a value
+	if len(values) != len(table.Columns) {
+		return nil, ErrSyntaxError
+	}
+	r, err := NewRow(values["id"].(int64), values["username"].(string), values["email"].(string))
+	if err != nil {
+		return nil, err
+	}
+	return &insertStatement{r: r}, nil
+}
+
+// NewRow checks that id, username and email fit
+// in the columns of the table and puts them in a row
+func NewRow(id int64, username, email string) (table.Row, error) {
+	r := table.Row{Id: id}
+	if len(username) > len(r.Username) || len(email) > len(r.Email) {
+		return r, ErrStringTooLong
 	}
-	if s.r.Id < 0 {
-		return nil, ErrNegativeId
+	if id < 0 {
+		return r, ErrNegativeId
 	}
+	copy(r.Username[:], []byte(username))
+	copy(r.Email[:], []byte(email))
+	return r, nil
+}
 
-	copy(s.r.Username[:], []byte(user))
-	copy(s.r.Email[:], []byte(email))
-	return &s, nil
+func (s *insertStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	return nil, insertErr(c.insert(ctx, s.r))
+}
+
+// insertRowsSavepoint is set by InsertRows
+// within the current transaction
+const insertRowsSavepoint = "insert rows"
+
+// InsertRows inserts rows in a single transaction: the
+// current one, if any, or else one of its own that is
+// committed once every row is in. A row that clashes with
+// another is skipped and handed to skip along with its
+// error. InsertRows returns how many rows went in
+func (c *Conn) InsertRows(ctx context.Context, rows []table.Row, skip func(i int, err error)) (int, error) {
+	tx := c.tx
+	if tx == nil {
+		var err error
+		if tx, err = c.t.Begin(); err != nil {
+			return 0, insertErr(err)
+		}
+	} else if err := tx.Savepoint(insertRowsSavepoint); err != nil {
+		// a failure leaves the current transaction
+		// as it was before the rows
+		return 0, err
+	}
+	n := 0
+	for i, r := range rows {
+		err := tx.Insert(ctx, r)
+		if err == table.ErrDuplicateKey {
+			skip(i, ErrDuplicateKey)
+			continue
+		}
+		if err != nil {
+			if c.tx == nil {
+				tx.Rollback()
+			} else {
+				tx.RollbackTo(insertRowsSavepoint)
+				tx.Release(insertRowsSavepoint)
+			}
+			return 0, insertErr(err)
+		}
+		n += 1
+	}
+	if c.tx != nil {
+		return n, tx.Release(insertRowsSavepoint)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, insertErr(err)
+	}
+	return n, nil
 }
 
-func (s *insertStatement) Execute(t *table.Table) error {
-	err := t.Insert(s.r)
-	if err == table.ErrTableFull {
+// insertErr translates the table's insert errors
+func insertErr(err error) error {
+	switch err {
+	case table.ErrTableFull:
 		return ErrTableFull
+	case table.ErrDuplicateKey:
+		return ErrDuplicateKey
+	case table.ErrDatabaseLocked:
+		return ErrDatabaseLocked
 	}
 	return err
 }
@@ -0,0 +1,54 @@
+package statement
+
+import (
+	"context"
+)
+
+type pragmaStatement struct {
+	name string
+}
+
+// preparePragma parses
+//
+//	pragma integrity_check
+func preparePragma(cmd string) (*pragmaStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("pragma"); err != nil {
+		return nil, err
+	}
+	s := &pragmaStatement{}
+	if s.name, err = p.ident(); err != nil {
+		return nil, err
+	}
+	if s.name != "integrity_check" {
+		return nil, ErrSyntaxError
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Execute returns a row per problem with the
+// database, or a single ok row if there is none
+func (s *pragmaStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	problems, err := c.t.Check()
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) == 0 {
+		problems = []string{"ok"}
+	}
+	res := &Result{
+		Columns: []string{s.name},
+		Types:   []string{"varchar"},
+		Rows:    [][]interface{}{},
+	}
+	for _, p := range problems {
+		res.Rows = append(res.Rows, []interface{}{p})
+	}
+	return res, nil
+}
@@ -1,32 +1,197 @@
 package statement
 
 import (
-	"bytes"
-	"fmt"
+	"context"
 	"github.com/sussadag/lets-build-a-simple-db/table"
+	"strings"
 )
 
 type selectStatement struct {
+	// columns to return, or nil for all of them
+	columns []string
+	// aggregates to return instead of columns
+	aggregates []aggregate
+	// where is nil when every row is selected
+	where *condition
+	// orderBy is the column to sort by, if any
+	orderBy string
+	desc    bool
+	// limit is -1 when every row is returned
+	limit int64
 }
 
+// prepareSelect parses
+//
+//	select
+//	select items from users [where condition]
+//		[order by column [asc | desc]] [limit n]
+//
+// where items is either *, a list of columns, or a list
+// of the aggregates count(*), count(column), min(column)
+// and max(column)
 func prepareSelect(cmd string) (*selectStatement, error) {
-	return &selectStatement{}, nil
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s := &selectStatement{limit: -1}
+	if err := p.expect("select"); err != nil {
+		return nil, err
+	}
+	if p.end() == nil {
+		return s, nil
+	}
+	if !p.accept("*") {
+		if err := parseSelectItems(p, s); err != nil {
+			return nil, err
+		}
+	}
+	if err := p.expect("from"); err != nil {
+		return nil, err
+	}
+	if err := parseTableName(p); err != nil {
+		return nil, err
+	}
+	if p.accept("where") {
+		if s.where, err = parseCondition(p); err != nil {
+			return nil, err
+		}
+	}
+	if p.accept("order") {
+		if err := p.expect("by"); err != nil {
+			return nil, err
+		}
+		if len(s.aggregates) > 0 {
+			// there is a single row to sort
+			return nil, ErrSyntaxError
+		}
+		if s.orderBy, err = parseColumn(p); err != nil {
+			return nil, err
+		}
+		if !p.accept("asc") {
+			s.desc = p.accept("desc")
+		}
+	}
+	if p.accept("limit") {
+		v, err := p.literal()
+		if err != nil {
+			return nil, err
+		}
+		limit, ok := v.(int64)
+		if !ok || limit < 0 {
+			return nil, ErrSyntaxError
+		}
+		s.limit = limit
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	return s, nil
 }
 
-func (s *selectStatement) Execute(t *table.Table) error {
-	for i := range t.GetRows() {
-		if i.Err != nil {
-			return i.Err
-		}
-		r := i.Row
-		fmt.Printf(
-			"(%d, %s, %s)\n",
-			r.Id,
-			// remove extra null characters in returned
-			// byte arrays
-			bytes.TrimRight(r.Username[:], "\x00"),
-			bytes.TrimRight(r.Email[:], "\x00"),
-		)
+// aggregateFuncs are the aggregate functions there are
+var aggregateFuncs = map[string]bool{
+	"count": true,
+	"min":   true,
+	"max":   true,
+}
+
+// parseSelectItems consumes the comma separated
+// columns or aggregates that s returns
+func parseSelectItems(p *parser, s *selectStatement) error {
+	for {
+		name, err := p.ident()
+		if err != nil {
+			return err
+		}
+		fn := strings.ToLower(name)
+		if aggregateFuncs[fn] && p.accept("(") {
+			agg := aggregate{fn: fn}
+			if fn != "count" || !p.accept("*") {
+				if agg.column, err = parseColumn(p); err != nil {
+					return err
+				}
+			}
+			if err := p.expect(")"); err != nil {
+				return err
+			}
+			s.aggregates = append(s.aggregates, agg)
+		} else {
+			if !table.IsColumn(name) {
+				return ErrNoSuchColumn
+			}
+			s.columns = append(s.columns, name)
+		}
+		if !p.accept(",") {
+			break
+		}
+	}
+	if len(s.columns) > 0 && len(s.aggregates) > 0 {
+		// there is no group by, so columns
+		// can't go along with aggregates
+		return ErrSyntaxError
 	}
 	return nil
 }
+
+// parseCondition consumes
+//
+//	column = value
+//	column between lo and hi
+func parseCondition(p *parser) (*condition, error) {
+	column, err := parseColumn(p)
+	if err != nil {
+		return nil, err
+	}
+	c := &condition{column: column}
+	if p.accept("between") {
+		if c.lo, err = parseValue(p, column); err != nil {
+			return nil, err
+		}
+		if err := p.expect("and"); err != nil {
+			return nil, err
+		}
+		if c.hi, err = parseValue(p, column); err != nil {
+			return nil, err
+		}
+		return c, nil
+	}
+	if err := p.expect("="); err != nil {
+		return nil, err
+	}
+	if c.lo, err = parseValue(p, column); err != nil {
+		return nil, err
+	}
+	c.hi = c.lo
+	return c, nil
+}
+
+// parseValue consumes a value of the type of column
+func parseValue(p *parser, column string) (interface{}, error) {
+	v, err := p.literal()
+	if err != nil {
+		return nil, err
+	}
+	if _, isInt := v.(int64); isInt != table.IsInteger(column) {
+		return nil, ErrTypeMismatch
+	}
+	return v, nil
+}
+
+func (s *selectStatement) Execute(ctx context.Context, conn *Conn) (*Result, error) {
+	res := &Result{Rows: [][]interface{}{}}
+	err := conn.reading(func() error {
+		plan := conn.plan(s)
+		for _, c := range plan.columns() {
+			res.Columns = append(res.Columns, c.Name)
+			res.Types = append(res.Types, c.Type)
+		}
+		return plan.run(ctx, conn, func(t tuple) {
+			res.Rows = append(res.Rows, t)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
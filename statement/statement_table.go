@@ -0,0 +1,147 @@
+package statement
+
+import (
+	"context"
+	"errors"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"strings"
+)
+
+// table specific errors
+var (
+	ErrTableExists   = errors.New("table already exists")
+	ErrSchemaChanged = errors.New("table does not match the schema of users")
+)
+
+// createTableStatement creates the users table, which
+// always exists. It is there so that the output of
+// .dump can be fed back
+type createTableStatement struct {
+	ifNotExists bool
+}
+
+// prepareCreateTable parses
+//
+//	create table [if not exists] users (column type, ...)
+//
+// where the columns have to be those of the table
+func prepareCreateTable(cmd string) (*createTableStatement, error) {
+	p, err := newParser(cmd)
+	if err != nil {
+		return nil, err
+	}
+	s := &createTableStatement{}
+	if err := p.expect("create"); err != nil {
+		return nil, err
+	}
+	if err := p.expect("table"); err != nil {
+		return nil, err
+	}
+	if p.accept("if") {
+		if err := p.expect("not"); err != nil {
+			return nil, err
+		}
+		if err := p.expect("exists"); err != nil {
+			return nil, err
+		}
+		s.ifNotExists = true
+	}
+	name, err := p.ident()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	columns := []table.Column{}
+	for {
+		var c table.Column
+		if c.Name, err = p.ident(); err != nil {
+			return nil, err
+		}
+		if c.Type, err = parseType(p); err != nil {
+			return nil, err
+		}
+		columns = append(columns, c)
+		if !p.accept(",") {
+			break
+		}
+	}
+	if err := p.expect(")"); err != nil {
+		return nil, err
+	}
+	if err := p.end(); err != nil {
+		return nil, err
+	}
+	if name != table.Name || len(columns) != len(table.Columns) {
+		return nil, ErrSchemaChanged
+	}
+	for i, c := range columns {
+		if c != table.Columns[i] {
+			return nil, ErrSchemaChanged
+		}
+	}
+	return s, nil
+}
+
+// parseType consumes the type of a column,
+// such as integer or varchar(32)
+func parseType(p *parser) (string, error) {
+	name, err := p.ident()
+	if err != nil {
+		return "", err
+	}
+	name = strings.ToLower(name)
+	if !p.accept("(") {
+		return name, nil
+	}
+	tok := p.peek()
+	if tok.kind != tokNumber {
+		return "", ErrSyntaxError
+	}
+	p.pos++
+	if err := p.expect(")"); err != nil {
+		return "", err
+	}
+	return name + "(" + tok.text + ")", nil
+}
+
+func (s *createTableStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	if c.tx != nil {
+		return nil, ErrSchemaInTx
+	}
+	if !s.ifNotExists {
+		return nil, ErrTableExists
+	}
+	return nil, nil
+}
+
+// CreateTable returns the statement that creates
+// the table, as .dump writes it
+func CreateTable() string {
+	columns := []string{}
+	for _, c := range table.Columns {
+		columns = append(columns, c.Name+" "+c.Type)
+	}
+	return "create table if not exists " + table.Name + " (" + strings.Join(columns, ", ") + ")"
+}
+
+// CreateIndex returns the statement that creates
+// the index def, as .dump writes it
+func CreateIndex(def table.IndexDef) string {
+	create := "create index "
+	if def.Unique {
+		create = "create unique index "
+	}
+	return create + def.Name + " on " + table.Name + "(" + def.Column + ")"
+}
+
+// InsertValues returns the statement that inserts
+// a row holding values, as .dump writes it
+func InsertValues(values []interface{}) string {
+	literals := make([]string, len(values))
+	for i, v := range values {
+		literals[i] = Literal(v)
+	}
+	return "insert into " + table.Name + " values (" + strings.Join(literals, ", ") + ")"
+}
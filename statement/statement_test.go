@@ -0,0 +1,170 @@
+package statement_test
+
+import (
+	"context"
+	"github.com/sussadag/lets-build-a-simple-db/statement"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// run prepares and executes cmd on c
+func run(t *testing.T, c *statement.Conn, tab *table.Table, cmd string) *statement.Result {
+	s, err := statement.Prepare(cmd, tab)
+	if err != nil {
+		t.Fatalf("Failed to prepare '%s': %s", cmd, err)
+	}
+	res, err := statement.Execute(context.Background(), s, c)
+	if err != nil {
+		t.Fatalf("Failed to execute '%s': %s", cmd, err)
+	}
+	return res
+}
+
+func TestSelectResult(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := statement.NewConn(tab)
+	if res := run(t, c, tab, "insert 1 sush sush@lala.com"); res != nil {
+		t.Fatalf("Expected no result from an insert, got %v", res)
+	}
+	run(t, c, tab, "insert 2 lala lala@lala.com")
+
+	res := run(t, c, tab, "select")
+	want := &statement.Result{
+		Columns: []string{"id", "username", "email"},
+		Types:   []string{"integer", "varchar(32)", "varchar(256)"},
+		Rows: [][]interface{}{
+			{int64(1), "sush", "sush@lala.com"},
+			{int64(2), "lala", "lala@lala.com"},
+		},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %v, got %v", want, res)
+	}
+
+	res = run(t, c, tab, "select email, id from users where id = 2")
+	want = &statement.Result{
+		Columns: []string{"email", "id"},
+		Types:   []string{"varchar(256)", "integer"},
+		Rows:    [][]interface{}{{"lala@lala.com", int64(2)}},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %v, got %v", want, res)
+	}
+
+	res = run(t, c, tab, "select count(*), max(username) from users where id = 3")
+	want = &statement.Result{
+		Columns: []string{"count(*)", "max(username)"},
+		Types:   []string{"integer", "varchar(32)"},
+		Rows:    [][]interface{}{{int64(0), nil}},
+	}
+	if !reflect.DeepEqual(res, want) {
+		t.Fatalf("Expected %v, got %v", want, res)
+	}
+
+	res = run(t, c, tab, "explain select * from users where id = 1")
+	if !reflect.DeepEqual(res.Plan, []string{"SEARCH users USING INDEX users_pkey (id = 1)"}) {
+		t.Fatalf("Unexpected plan %v", res.Plan)
+	}
+}
+
+func TestInsertRowsInTransaction(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := statement.NewConn(tab)
+	run(t, c, tab, "begin")
+	run(t, c, tab, "insert 1 sush sush@lala.com")
+
+	rows := []table.Row{}
+	for _, id := range []int64{2, 1, 3} {
+		r, err := statement.NewRow(id, "user", "user@lala.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		rows = append(rows, r)
+	}
+	skipped := []int{}
+	n, err := c.InsertRows(context.Background(), rows, func(i int, err error) {
+		if err != statement.ErrDuplicateKey {
+			t.Fatalf("Expected %v, got %v", statement.ErrDuplicateKey, err)
+		}
+		skipped = append(skipped, i)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 || !reflect.DeepEqual(skipped, []int{1}) {
+		t.Fatalf("Expected 2 rows in and row 1 skipped, got %d in and %v skipped", n, skipped)
+	}
+
+	// the rows belong to the transaction
+	run(t, c, tab, "rollback")
+	res := run(t, c, tab, "select")
+	if len(res.Rows) != 0 {
+		t.Fatalf("Expected no rows after rollback, got %v", res.Rows)
+	}
+}
+
+func TestSplitter(t *testing.T) {
+	sp := &statement.Splitter{}
+	lines := []string{
+		"select; insert 1 a 'b;c'; -- one; two\n",
+		"select id /* from;\n",
+		"*/ from users\n",
+		"where id = 1;;\n",
+		"insert into users values (2, 'it''s\n",
+		"', 'x');select\n",
+	}
+	got := []string{}
+	for _, line := range lines {
+		got = append(got, sp.Feed(line)...)
+	}
+	want := []string{
+		"select",
+		"insert 1 a 'b;c'",
+		"select id   from users\nwhere id = 1",
+		"insert into users values (2, 'it''s\n', 'x')",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("Expected %q, got %q", want, got)
+	}
+	if !sp.Pending() {
+		t.Fatal("Expected the last select to be pending")
+	}
+	if stmt := sp.Flush(); stmt != "select" {
+		t.Fatalf("Expected the last select, got %q", stmt)
+	}
+	if sp.Pending() {
+		t.Fatal("Expected nothing to be pending after a flush")
+	}
+
+	// comments only start words
+	cases := []struct {
+		text string
+		want []string
+	}{
+		{"insert 1 a--b x@y;", []string{"insert 1 a--b x@y"}},
+		{"insert 1 a/*b x@y*/;", []string{"insert 1 a/*b x@y*/"}},
+		{"insert 1 a b--c;", []string{"insert 1 a b--c"}},
+		{"select;--x;\nselect;", []string{"select", "select"}},
+		{"select /*x*/--y;\n;", []string{"select"}},
+	}
+	for _, c := range cases {
+		sp := &statement.Splitter{}
+		if got := sp.Feed(c.text); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("Expected %q from %q, got %q", c.want, c.text, got)
+		}
+	}
+}
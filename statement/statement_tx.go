@@ -0,0 +1,165 @@
+package statement
+
+import (
+	"context"
+	"errors"
+	"github.com/sussadag/lets-build-a-simple-db/table"
+	"strings"
+)
+
+// transaction specific errors
+var (
+	ErrNoTransaction     = errors.New("no transaction is active")
+	ErrTransactionActive = errors.New("a transaction is already active")
+	ErrNoSavepoint       = errors.New("no such savepoint")
+)
+
+const (
+	txBegin = iota
+	txCommit
+	txRollback
+	txSavepoint
+	txRelease
+	txRollbackTo
+)
+
+type txStatement struct {
+	op int
+	// name of the savepoint, if any
+	name string
+}
+
+var txKeywords = map[string]int{
+	"begin":     txBegin,
+	"commit":    txCommit,
+	"end":       txCommit,
+	"rollback":  txRollback,
+	"savepoint": txSavepoint,
+	"release":   txRelease,
+}
+
+// isTxStatement reports whether cmd starts with
+// one of the transaction control keywords
+func isTxStatement(cmd string) bool {
+	fields := strings.Fields(cmd)
+	if len(fields) == 0 {
+		return false
+	}
+	_, ok := txKeywords[fields[0]]
+	return ok
+}
+
+// prepareTx parses
+//
+//	begin [transaction]
+//	commit [transaction] | end [transaction]
+//	rollback [transaction]
+//	rollback [transaction] to [savepoint] name
+//	savepoint name
+//	release [savepoint] name
+func prepareTx(cmd string) (*txStatement, error) {
+	fields := strings.Fields(cmd)
+	s := &txStatement{op: txKeywords[fields[0]]}
+	rest := fields[1:]
+	switch s.op {
+	case txSavepoint:
+		if len(rest) != 1 {
+			return nil, ErrSyntaxError
+		}
+		s.name = rest[0]
+		return s, nil
+	case txRelease:
+		rest = skipKeyword(rest, "savepoint")
+		if len(rest) != 1 {
+			return nil, ErrSyntaxError
+		}
+		s.name = rest[0]
+		return s, nil
+	}
+
+	rest = skipKeyword(rest, "transaction")
+	if s.op == txRollback && len(rest) > 0 && rest[0] == "to" {
+		rest = skipKeyword(rest[1:], "savepoint")
+		if len(rest) != 1 {
+			return nil, ErrSyntaxError
+		}
+		s.op = txRollbackTo
+		s.name = rest[0]
+		return s, nil
+	}
+	if len(rest) != 0 {
+		return nil, ErrSyntaxError
+	}
+	return s, nil
+}
+
+// skipKeyword drops the optional keyword kw
+// from the front of fields
+func skipKeyword(fields []string, kw string) []string {
+	if len(fields) > 0 && fields[0] == kw {
+		return fields[1:]
+	}
+	return fields
+}
+
+// Execute runs s. Transaction control
+// statements return no result
+func (s *txStatement) Execute(ctx context.Context, c *Conn) (*Result, error) {
+	return nil, s.execute(c)
+}
+
+func (s *txStatement) execute(c *Conn) error {
+	switch s.op {
+	case txBegin:
+		if c.tx != nil {
+			return ErrTransactionActive
+		}
+		tx, err := c.t.Begin()
+		if err != nil {
+			return err
+		}
+		c.tx = tx
+		return nil
+	case txCommit:
+		if c.tx == nil {
+			return ErrNoTransaction
+		}
+		err := c.tx.Commit()
+		c.tx = nil
+		if err == table.ErrTableFull {
+			return ErrTableFull
+		}
+		return err
+	case txRollback:
+		if c.tx == nil {
+			return ErrNoTransaction
+		}
+		err := c.tx.Rollback()
+		c.tx = nil
+		return err
+	case txSavepoint:
+		if c.tx == nil {
+			return ErrNoTransaction
+		}
+		return c.tx.Savepoint(s.name)
+	case txRelease:
+		if c.tx == nil {
+			return ErrNoTransaction
+		}
+		return savepointErr(c.tx.Release(s.name))
+	case txRollbackTo:
+		if c.tx == nil {
+			return ErrNoTransaction
+		}
+		return savepointErr(c.tx.RollbackTo(s.name))
+	}
+	return nil
+}
+
+// savepointErr translates the table's savepoint errors
+func savepointErr(err error) error {
+	if err == table.ErrNoSavepoint {
+		return ErrNoSavepoint
+	}
+	return err
+}
@@ -0,0 +1,256 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+)
+
+// ErrBackupOntoItself is returned by Backup when asked
+// to write the copy over the database file itself
+var ErrBackupOntoItself = errors.New("cannot back up a database onto itself")
+
+// ErrBadBackup is returned by Restore when the
+// file is not a sound backup of a database
+var ErrBadBackup = errors.New("not a valid backup")
+
+// ErrRestored is returned by a cursor whose
+// rows were replaced by a Restore
+var ErrRestored = errors.New("database was restored while being read")
+
+// isDatabase reports whether path is the
+// database file, under any name
+func (t *Table) isDatabase(path string) (bool, error) {
+	target, err := os.Stat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	db, err := t.p.f.Stat()
+	if err != nil {
+		return false, err
+	}
+	return os.SameFile(target, db), nil
+}
+
+// committedState returns the number of committed rows along
+// with the encoded catalog and the number of restores that
+// go with them, after catching up with other processes
+func (t *Table) committedState() (uint, []byte, uint64, error) {
+	unlock, isWriter, err := t.lock.lockShared()
+	if err != nil {
+		return 0, nil, 0, err
+	}
+	defer unlock()
+	if !isWriter {
+		if err := t.refresh(); err != nil {
+			return 0, nil, 0, err
+		}
+	}
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.nextFreeRow, t.catalog, t.restores, nil
+}
+
+// Backup writes a copy of the database, as it was committed
+// when Backup started, to the file at path. The copy only
+// replaces path once it is complete, and never replaces
+// the database file itself.
+//
+// Commits carry on while the pages are copied: they only
+// append rows past the ones being copied. Should the rows
+// be replaced by a Restore in the meantime, the copy starts
+// over
+func (t *Table) Backup(ctx context.Context, path string) error {
+	for {
+		numRows, catalog, restores, err := t.committedState()
+		if err != nil {
+			return err
+		}
+		if err := t.backup(ctx, path, numRows, catalog); err != nil {
+			return err
+		}
+		_, _, after, err := t.committedState()
+		if err != nil {
+			return err
+		}
+		if after == restores {
+			return nil
+		}
+	}
+}
+
+// backup copies the first numRows rows, and a meta page
+// holding catalog, to the file at path
+func (t *Table) backup(ctx context.Context, path string, numRows uint, catalog []byte) (err error) {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			f.Close()
+			os.Remove(f.Name())
+		}
+	}()
+	for pageNum := uint(0); pageNum*rowsPerPage < numRows; pageNum++ {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rows := numRows - pageNum*rowsPerPage
+		if rows > rowsPerPage {
+			rows = rowsPerPage
+		}
+		p, err := t.p.getPage(pageNum)
+		if err != nil {
+			return err
+		}
+		// a writer may be filling in the
+		// rest of the last page
+		if _, err := f.WriteAt(p[:rows*rowSize], int64(pageNum*rowsPerPage*rowSize)); err != nil {
+			return err
+		}
+	}
+	dst := &pager{f: f}
+	if err := dst.writeMeta(numRows, catalog); err != nil {
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	// renaming the copy over the database would leave
+	// it writing to a file that is no longer there
+	same, err := t.isDatabase(path)
+	if err != nil {
+		return err
+	}
+	if same {
+		return ErrBackupOntoItself
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// Restore replaces every row, index and statistic of the
+// database with those of the backup at path, which has to
+// be sound: a file that isn't one Backup wrote, or that
+// Check would find problems with, fails with ErrBadBackup
+// and leaves the database as it was. Restore waits for
+// other writers like a transaction does, and keeps readers
+// out while it writes.
+//
+// Restore can't be undone. The backup is first copied into
+// the database file past its rows, so a crash before that
+// is done leaves the database as it was, and a crash after
+// has the restore finished by the next process to open the
+// database or to write to it. Cursors that were open during
+// a Restore may see rows of either database
+func (t *Table) Restore(ctx context.Context, path string) error {
+	rows, c, err := readBackup(path)
+	if err != nil {
+		return err
+	}
+	data := make([]byte, 0, uint(len(rows))*rowSize)
+	var p page
+	for _, r := range rows {
+		insertIntoPage(&p, r, 0)
+		data = append(data, p[:rowSize]...)
+	}
+	numRows := uint(len(rows))
+	indexes, err := addRows(newIndexes(c), rows, 0)
+	if err != nil {
+		return err
+	}
+	for _, idx := range indexes {
+		if idx.def.Unique && idx.tree.hasDuplicates() {
+			return ErrBadBackup
+		}
+	}
+
+	if err := t.lockWriter(ctx); err != nil {
+		return err
+	}
+	defer t.unlockWriter()
+	t.mu.RLock()
+	c.Restores = t.restores + 1
+	t.mu.RUnlock()
+	cat, err := c.encode()
+	if err != nil {
+		return err
+	}
+	if err := t.lock.lockCommit(); err != nil {
+		return err
+	}
+	defer t.lock.unlockCommit()
+	if err := t.p.stageRestore(data, numRows, cat); err != nil {
+		return err
+	}
+	// cursors must not read the rows
+	// as they are being replaced
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, err := t.p.finishRestore(); err != nil {
+		return err
+	}
+	t.p.invalidate()
+	t.p.committed(numRows)
+	t.nextFreeRow = numRows
+	t.indexes = indexes
+	t.numIndexed = numRows
+	t.stats = c.Stats
+	t.catalog = cat
+	t.restores = c.Restores
+	return nil
+}
+
+// readBackup reads the rows and the catalog of the backup
+// at path, checking them the way Check checks a database
+func readBackup(path string) ([]Row, catalog, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, catalog{}, err
+	}
+	defer f.Close()
+	src := &pager{f: f}
+	meta, err := src.readMetaPage()
+	if err != nil {
+		return nil, catalog{}, err
+	}
+	// a file without a meta page is taken to be all
+	// rows, so any file at all would pass for one
+	if ok, _ := isMeta(meta[:]); !ok {
+		return nil, catalog{}, ErrBadBackup
+	}
+	numRows, b, err := src.readMeta()
+	if err == errCorruptMeta {
+		return nil, catalog{}, ErrBadBackup
+	}
+	if err != nil {
+		return nil, catalog{}, err
+	}
+	c, err := decodeCatalog(b)
+	if err != nil {
+		return nil, catalog{}, ErrBadBackup
+	}
+	problems := 0
+	report := func(string, ...interface{}) {
+		problems++
+	}
+	sums, err := src.checkMeta(numRows, report)
+	if err != nil {
+		return nil, catalog{}, err
+	}
+	rows, err := src.checkRows(numRows, sums, report)
+	if err != nil {
+		return nil, catalog{}, err
+	}
+	if problems > 0 {
+		return nil, catalog{}, ErrBadBackup
+	}
+	return rows, c, nil
+}
@@ -0,0 +1,199 @@
+package table
+
+import (
+	"sort"
+)
+
+// btreeDegree is the minimum degree of the B-tree: every
+// node but the root holds between btreeDegree-1 and
+// 2*btreeDegree-1 entries
+const btreeDegree = 8
+
+const maxNodeEntries = 2*btreeDegree - 1
+
+// indexEntry is an entry of an index: the key built from
+// the indexed column of a row, along with the position of
+// that row. The position keeps entries with the same key
+// apart and in insertion order
+type indexEntry struct {
+	key    string
+	rowNum uint
+}
+
+func (e indexEntry) less(o indexEntry) bool {
+	if e.key != o.key {
+		return e.key < o.key
+	}
+	return e.rowNum < o.rowNum
+}
+
+// btree is an in-memory B-tree of index entries.
+//
+// A btree is never modified once built: insert returns a
+// new tree that shares every node it didn't have to change
+// with the old one. A reader can thus keep walking the tree
+// it started with while the writer moves on
+type btree struct {
+	root *btreeNode
+	size int
+}
+
+type btreeNode struct {
+	entries []indexEntry
+	// children is nil for leaf nodes. Otherwise
+	// children[i] holds the entries that sort
+	// before entries[i]
+	children []*btreeNode
+}
+
+func (n *btreeNode) isLeaf() bool {
+	return n.children == nil
+}
+
+// insert returns a copy of b with e added
+func (b *btree) insert(e indexEntry) *btree {
+	if b.root == nil {
+		return &btree{
+			root: &btreeNode{entries: []indexEntry{e}},
+			size: 1,
+		}
+	}
+	left, median, right := b.root.insert(e)
+	root := left
+	if right != nil {
+		root = &btreeNode{
+			entries:  []indexEntry{median},
+			children: []*btreeNode{left, right},
+		}
+	}
+	return &btree{root: root, size: b.size + 1}
+}
+
+// insert returns a copy of the subtree at n with e added.
+// If the copy overflowed, it comes back split in two
+// around median, and right is not nil
+func (n *btreeNode) insert(e indexEntry) (left *btreeNode, median indexEntry, right *btreeNode) {
+	c := &btreeNode{
+		entries: make([]indexEntry, len(n.entries), len(n.entries)+1),
+	}
+	copy(c.entries, n.entries)
+	i := sort.Search(len(c.entries), func(j int) bool {
+		return e.less(c.entries[j])
+	})
+	if n.isLeaf() {
+		c.entries = insertEntry(c.entries, i, e)
+	} else {
+		c.children = make([]*btreeNode, len(n.children), len(n.children)+1)
+		copy(c.children, n.children)
+		l, m, r := n.children[i].insert(e)
+		c.children[i] = l
+		if r != nil {
+			c.entries = insertEntry(c.entries, i, m)
+			c.children = append(c.children, nil)
+			copy(c.children[i+2:], c.children[i+1:])
+			c.children[i+1] = r
+		}
+	}
+	if len(c.entries) <= maxNodeEntries {
+		return c, indexEntry{}, nil
+	}
+
+	// split the overflowing node in two
+	mid := len(c.entries) / 2
+	right = &btreeNode{
+		entries: append([]indexEntry(nil), c.entries[mid+1:]...),
+	}
+	median = c.entries[mid]
+	c.entries = c.entries[:mid:mid]
+	if !c.isLeaf() {
+		right.children = append([]*btreeNode(nil), c.children[mid+1:]...)
+		c.children = c.children[: mid+1 : mid+1]
+	}
+	return c, median, right
+}
+
+func insertEntry(entries []indexEntry, i int, e indexEntry) []indexEntry {
+	entries = append(entries, indexEntry{})
+	copy(entries[i+1:], entries[i:])
+	entries[i] = e
+	return entries
+}
+
+// btreeIter walks the entries of a btree in order
+type btreeIter struct {
+	// stack holds the path from the root to the next
+	// entry. For each node, i is the position of the
+	// next entry of that node to return
+	stack []btreeFrame
+}
+
+type btreeFrame struct {
+	n *btreeNode
+	i int
+}
+
+// seek returns an iterator positioned at the
+// first entry whose key is not less than key
+func (b *btree) seek(key string) *btreeIter {
+	it := &btreeIter{}
+	target := indexEntry{key: key}
+	for n := b.root; n != nil; {
+		i := sort.Search(len(n.entries), func(j int) bool {
+			return !n.entries[j].less(target)
+		})
+		it.stack = append(it.stack, btreeFrame{n, i})
+		if n.isLeaf() {
+			break
+		}
+		n = n.children[i]
+	}
+	return it
+}
+
+// next returns the next entry, or false
+// once every entry has been returned
+func (it *btreeIter) next() (indexEntry, bool) {
+	for len(it.stack) > 0 {
+		f := &it.stack[len(it.stack)-1]
+		if f.i >= len(f.n.entries) {
+			it.stack = it.stack[:len(it.stack)-1]
+			continue
+		}
+		e := f.n.entries[f.i]
+		f.i += 1
+		if !f.n.isLeaf() {
+			// the entries of the next child come
+			// before the next entry of this node
+			for n := f.n.children[f.i]; n != nil; {
+				it.stack = append(it.stack, btreeFrame{n, 0})
+				if n.isLeaf() {
+					break
+				}
+				n = n.children[0]
+			}
+		}
+		return e, true
+	}
+	return indexEntry{}, false
+}
+
+// has reports whether an entry of b has key
+func (b *btree) has(key string) bool {
+	e, ok := b.seek(key).next()
+	return ok && e.key == key
+}
+
+// hasDuplicates reports whether two
+// entries of b have the same key
+func (b *btree) hasDuplicates() bool {
+	it := b.seek("")
+	prev, ok := it.next()
+	for ok {
+		var e indexEntry
+		if e, ok = it.next(); ok && e.key == prev.key {
+			return true
+		}
+		prev = e
+	}
+	return false
+}
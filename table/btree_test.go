@@ -0,0 +1,55 @@
+package table
+
+import (
+	"fmt"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+func TestBtreeKeepsEntriesInOrder(t *testing.T) {
+	keys := rand.Perm(1000)
+	b := &btree{}
+	trees := []*btree{}
+	for i, k := range keys {
+		b = b.insert(indexEntry{key: fmt.Sprintf("%04d", k), rowNum: uint(i)})
+		trees = append(trees, b)
+	}
+	if b.size != len(keys) {
+		t.Fatalf("Expected %d entries, got %d", len(keys), b.size)
+	}
+
+	// every tree still holds exactly what it held
+	// when it was built, in order
+	for i, tree := range trees {
+		want := []string{}
+		for _, k := range keys[:i+1] {
+			want = append(want, fmt.Sprintf("%04d", k))
+		}
+		sort.Strings(want)
+		it := tree.seek("")
+		for _, w := range want {
+			e, ok := it.next()
+			if !ok || e.key != w {
+				t.Fatalf("tree %d: expected key %s, got %s (%v)", i, w, e.key, ok)
+			}
+		}
+		if _, ok := it.next(); ok {
+			t.Fatalf("tree %d: more entries than inserted", i)
+		}
+	}
+
+	it := b.seek("0500")
+	if e, ok := it.next(); !ok || e.key != "0500" {
+		t.Fatalf("Expected to seek to 0500, got %s", e.key)
+	}
+	if !b.has("0999") || b.has("1000") {
+		t.Fatalf("has is wrong")
+	}
+	if b.hasDuplicates() {
+		t.Fatalf("Expected no duplicates")
+	}
+	if !b.insert(indexEntry{key: "0123", rowNum: 5000}).hasDuplicates() {
+		t.Fatalf("Expected duplicates")
+	}
+}
@@ -0,0 +1,285 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Check verifies the database file and the indexes built
+// from it, and returns every problem it finds. No problems
+// means the database is sound.
+//
+// The meta page must be well formed, match its checksum
+// and agree with the rows the table holds. Every page of
+// rows is read straight off disk and must match the checksum
+// the meta page holds for it, and every row must be one the
+// table could have written. The B-tree of every index must
+// be ordered within and across its nodes, balanced, and hold
+// an entry for each row and no other.
+//
+// Files written before pages had checksums are checked
+// without them until their next commit. The file has no
+// freelist: rows are never deleted, and pages of rows are
+// laid out one after the other, so they are all reachable
+// by construction.
+//
+// Other processes can't commit until Check is done
+func (t *Table) Check() ([]string, error) {
+	// as snapshot does, but keeping the file as it
+	// is until the end
+	unlock, isWriter, err := t.lock.lockShared()
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	if !isWriter {
+		if err := t.refresh(); err != nil {
+			return nil, err
+		}
+	}
+	snap := t.current()
+	problems := []string{}
+	report := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	sums, err := t.p.checkMeta(snap.numRows, report)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := t.p.checkRows(snap.numRows, sums, report)
+	if err != nil {
+		return nil, err
+	}
+	for _, idx := range snap.indexes {
+		idx.check(rows, report)
+	}
+	return problems, nil
+}
+
+// checkMeta checks the meta page against numRows, the
+// rows the table holds. It returns the checksums of the
+// pages of rows, if the meta page has sound ones
+func (pag *pager) checkMeta(numRows uint, report func(string, ...interface{})) ([]uint32, error) {
+	fileInfo, err := pag.f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fileInfo.Size()
+	meta, err := pag.readMetaPage()
+	if err != nil {
+		return nil, err
+	}
+	ok, summed := isMeta(meta[:])
+	if !ok {
+		if size > metaOffset {
+			report("meta page: bad magic %q", meta[:len(metaMagic)])
+		}
+		// files written before the meta page existed
+		// only hold rows
+		if size%int64(rowSize) != 0 {
+			report("file size %d is not a whole number of rows", size)
+		}
+		return nil, nil
+	}
+	var sums []uint32
+	if summed {
+		if sum := metaSum(meta[:]); sum != storedMetaSum(meta[:]) {
+			report("meta page: checksum is %08x, expected %08x", sum, storedMetaSum(meta[:]))
+		} else {
+			sums = pageSums(meta[:])
+		}
+	}
+
+	headerRows := uint(binary.LittleEndian.Uint64(meta[16:24]))
+	catalogLen := int(binary.LittleEndian.Uint32(meta[24:28]))
+	if headerRows != numRows {
+		report("meta page: row count is %d, but the table holds %d rows", headerRows, numRows)
+	}
+	if headerRows > maxNumRows {
+		report("meta page: row count %d is more than the %d rows that fit", headerRows, maxNumRows)
+	}
+	maxLen := pageSize - metaHeaderSize
+	if summed {
+		maxLen = maxCatalogSize
+	}
+	if catalogLen > maxLen {
+		report("meta page: catalog length %d is more than the %d bytes that fit", catalogLen, maxLen)
+		return sums, nil
+	}
+	c, err := decodeCatalog(meta[metaHeaderSize : metaHeaderSize+catalogLen])
+	if err != nil {
+		report("meta page: catalog does not decode: %s", err)
+		return sums, nil
+	}
+	seen := map[string]bool{PrimaryKey.Name: true}
+	for _, def := range c.Indexes {
+		if seen[def.Name] {
+			report("catalog: index %s is defined twice", def.Name)
+		}
+		seen[def.Name] = true
+		if !IsColumn(def.Column) {
+			report("catalog: index %s is on column %s, which does not exist", def.Name, def.Column)
+		}
+	}
+	return sums, nil
+}
+
+// checkRows reads the first numRows rows straight off
+// disk, bypassing the page cache, and checks each one.
+// Each page is checked against sums, if given
+func (pag *pager) checkRows(numRows uint, sums []uint32, report func(string, ...interface{})) ([]Row, error) {
+	rows := make([]Row, 0, numRows)
+	buf := make([]byte, rowsPerPage*rowSize)
+	for pageNum := uint(0); pageNum*rowsPerPage < numRows; pageNum++ {
+		n := numRows - pageNum*rowsPerPage
+		if n > rowsPerPage {
+			n = rowsPerPage
+		}
+		read, err := pag.f.ReadAt(buf[:n*rowSize], int64(pageNum*rowsPerPage*rowSize))
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if uint(read) < n*rowSize {
+			report("page %d: holds %d bytes of rows, expected %d", pageNum, read, n*rowSize)
+			// treat the missing rows as zeros
+			for i := read; i < len(buf); i++ {
+				buf[i] = 0
+			}
+		} else if sums != nil {
+			if sum := crc32.ChecksumIEEE(buf[:n*rowSize]); sum != sums[pageNum] {
+				report("page %d: checksum is %08x, expected %08x", pageNum, sum, sums[pageNum])
+			}
+		}
+		var p page
+		copy(p[:], buf)
+		for i := uint(0); i < n; i++ {
+			rowNum := pageNum*rowsPerPage + i
+			r := readFromPage(&p, i)
+			if r.Id < 0 {
+				report("row %d: id %d is negative", rowNum, r.Id)
+			}
+			if !zeroPadded(r.Username[:]) {
+				report("row %d: username has bytes after its end", rowNum)
+			}
+			if !zeroPadded(r.Email[:]) {
+				report("row %d: email has bytes after its end", rowNum)
+			}
+			rows = append(rows, r)
+		}
+	}
+	return rows, nil
+}
+
+// zeroPadded reports whether b is a string
+// followed by nothing but zeros
+func zeroPadded(b []byte) bool {
+	end := bytes.IndexByte(b, 0)
+	return end < 0 || len(bytes.TrimRight(b[end:], "\x00")) == 0
+}
+
+// check checks that the B-tree of idx is sound and
+// holds an entry for each of rows and no other
+func (idx *index) check(rows []Row, report func(string, ...interface{})) {
+	name := idx.def.Name
+	problem := func(format string, args ...interface{}) {
+		report("index "+name+": "+format, args...)
+	}
+	if idx.tree.root != nil {
+		leafDepth := -1
+		idx.tree.root.check(true, nil, nil, 0, &leafDepth, problem)
+	}
+
+	expected := make([]indexEntry, len(rows))
+	for i, r := range rows {
+		key, _ := r.columnKey(idx.def.Column)
+		expected[i] = indexEntry{key: key, rowNum: uint(i)}
+	}
+	sort.Slice(expected, func(i, j int) bool {
+		return expected[i].less(expected[j])
+	})
+	if idx.tree.size != len(rows) {
+		problem("holds %d entries for %d rows", idx.tree.size, len(rows))
+	}
+	it := idx.tree.seek("")
+	i := 0
+	for e, ok := it.next(); ok; e, ok = it.next() {
+		if i < len(expected) && e != expected[i] {
+			problem("entry %d is %s@%d, expected %s@%d", i,
+				idx.format(e.key), e.rowNum, idx.format(expected[i].key), expected[i].rowNum)
+			// one is enough, every later
+			// entry is likely off as well
+			i = -1
+			break
+		}
+		i++
+	}
+	if i >= 0 && i != len(expected) {
+		problem("has %d entries in order, expected %d", i, len(expected))
+	}
+	if idx.def.Unique {
+		for i := 1; i < len(expected); i++ {
+			if expected[i].key == expected[i-1].key {
+				problem("rows %d and %d have the same key %s", expected[i-1].rowNum,
+					expected[i].rowNum, idx.format(expected[i].key))
+			}
+		}
+	}
+}
+
+// format writes a key of idx the way it is written in sql
+func (idx *index) format(key string) string {
+	switch v := decodeKey(idx.def.Column, key).(type) {
+	case string:
+		return "'" + strings.Replace(v, "'", "''", -1) + "'"
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// check checks the subtree at n. Its entries have to sort
+// after lo and before hi, when they are given, and its
+// leaves have to be as deep as every other leaf
+func (n *btreeNode) check(root bool, lo, hi *indexEntry, depth int, leafDepth *int, problem func(string, ...interface{})) {
+	if !root && len(n.entries) < btreeDegree-1 {
+		problem("node at depth %d has %d entries, fewer than %d", depth, len(n.entries), btreeDegree-1)
+	}
+	if len(n.entries) > maxNodeEntries {
+		problem("node at depth %d has %d entries, more than %d", depth, len(n.entries), maxNodeEntries)
+	}
+	for i, e := range n.entries {
+		if i > 0 && !n.entries[i-1].less(e) {
+			problem("node at depth %d: entry %d is out of order", depth, i)
+		}
+		if (lo != nil && !lo.less(e)) || (hi != nil && !e.less(*hi)) {
+			problem("node at depth %d: entry %d is outside of the range of its parent", depth, i)
+		}
+	}
+	if n.isLeaf() {
+		if *leafDepth < 0 {
+			*leafDepth = depth
+		} else if depth != *leafDepth {
+			problem("leaf at depth %d, while others are at depth %d", depth, *leafDepth)
+		}
+		return
+	}
+	if len(n.children) != len(n.entries)+1 {
+		problem("node at depth %d has %d entries but %d children", depth, len(n.entries), len(n.children))
+		return
+	}
+	for i, child := range n.children {
+		childLo, childHi := lo, hi
+		if i > 0 {
+			childLo = &n.entries[i-1]
+		}
+		if i < len(n.entries) {
+			childHi = &n.entries[i]
+		}
+		child.check(false, childLo, childHi, depth+1, leafDepth, problem)
+	}
+}
@@ -0,0 +1,94 @@
+package table
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// Name is the name of the only table we support
+const Name = "users"
+
+var (
+	ErrNoSuchColumn = errors.New("no such column")
+	ErrTypeMismatch = errors.New("value does not match the type of the column")
+)
+
+// Column describes a column of the table
+type Column struct {
+	Name string
+	// Type is the type of the column as
+	// written in sql
+	Type string
+}
+
+// Columns lists the columns of the table in order
+var Columns = []Column{
+	{Name: "id", Type: "integer"},
+	{Name: "username", Type: "varchar(32)"},
+	{Name: "email", Type: "varchar(256)"},
+}
+
+// IsInteger reports whether column holds integers.
+// Every other column holds strings
+func IsInteger(column string) bool {
+	return column == "id"
+}
+
+// Value returns the value of column in r: an int64
+// for integer columns and a string for the others
+func (r Row) Value(column string) (interface{}, error) {
+	switch column {
+	case "id":
+		return r.Id, nil
+	case "username":
+		return string(bytes.TrimRight(r.Username[:], "\x00")), nil
+	case "email":
+		return string(bytes.TrimRight(r.Email[:], "\x00")), nil
+	}
+	return nil, ErrNoSuchColumn
+}
+
+// encodeKey turns a column value into an index key.
+// Keys of integers sort the same way as the integers
+func encodeKey(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case int64:
+		// big endian with the sign bit flipped puts
+		// negative numbers before positive ones
+		var b [8]byte
+		binary.BigEndian.PutUint64(b[:], uint64(v)^(1<<63))
+		return string(b[:]), nil
+	case string:
+		return v, nil
+	}
+	return "", ErrTypeMismatch
+}
+
+// decodeKey turns an index key of column
+// back into the value it was built from
+func decodeKey(column, key string) interface{} {
+	if IsInteger(column) && len(key) == 8 {
+		return int64(binary.BigEndian.Uint64([]byte(key)) ^ (1 << 63))
+	}
+	return key
+}
+
+// columnKey returns the index key of column in r
+func (r Row) columnKey(column string) (string, error) {
+	v, err := r.Value(column)
+	if err != nil {
+		return "", err
+	}
+	return encodeKey(v)
+}
+
+// IsColumn reports whether the table has column
+func IsColumn(column string) bool {
+	for _, c := range Columns {
+		if c.Name == column {
+			return true
+		}
+	}
+	return false
+}
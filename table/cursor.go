@@ -0,0 +1,317 @@
+package table
+
+import (
+	"context"
+	"sort"
+)
+
+// Cursor walks the rows of a Table in insertion order,
+// or in key order when it goes through an index.
+// A Cursor must only be used by one goroutine at a time.
+// Rows are pulled one at a time, so a caller can stop
+// at any point by simply calling Close:
+//
+//	c := t.Cursor(ctx)
+//	defer c.Close()
+//	for c.Next() {
+//		r := c.Row()
+//		...
+//	}
+//	if err := c.Err(); err != nil {
+//		...
+//	}
+type Cursor struct {
+	ctx context.Context
+	t   *Table
+	// rowNum is the position of the row that the
+	// next call to Next will read
+	rowNum uint
+	// end is one past the last committed row
+	// visible to this cursor. Rows committed after
+	// the cursor was created are not returned
+	end uint
+	// indexes hold the rows up to end, starting
+	// with the primary key
+	indexes []*index
+	// restores is the number of restores done when the
+	// cursor was created. Once there is another one,
+	// the rows up to end are gone
+	restores uint64
+	// pending holds the uncommitted rows of the
+	// transaction the cursor belongs to. They come
+	// after the committed rows
+	pending []Row
+
+	// it walks the entries of an index up to the
+	// key last, when the cursor goes through an index
+	it   *btreeIter
+	last string
+	// head is the next entry of it, once peeked at
+	head       indexEntry
+	headOk     bool
+	headPeeked bool
+	// pendingEntries are the entries of the pending
+	// rows in the index, in order. They are merged
+	// with the entries of it
+	pendingEntries []indexEntry
+	// match, if set, filters the rows
+	// the cursor returns
+	match func(Row) bool
+
+	// pagesRead counts the pages the cursor moved
+	// to, lastPage being the one it is on
+	pagesRead int
+	lastPage  uint
+
+	row    Row
+	err    error
+	closed bool
+}
+
+// Cursor returns a cursor positioned before
+// the first row of the table. The cursor stops
+// with ctx's error once ctx is done
+func (t *Table) Cursor(ctx context.Context) *Cursor {
+	snap, err := t.snapshot()
+	return &Cursor{
+		ctx:      ctx,
+		t:        t,
+		end:      snap.numRows,
+		indexes:  snap.indexes,
+		restores: snap.restores,
+		err:      err,
+	}
+}
+
+// where restricts the cursor to the rows whose column holds
+// a value between lo and hi, going through an index on
+// column from indexes if there is one
+func (c *Cursor) where(indexes []*index, column string, lo, hi interface{}) {
+	if c.err != nil {
+		return
+	}
+	if !IsColumn(column) {
+		c.err = ErrNoSuchColumn
+		return
+	}
+	first, err := columnValueKey(column, lo)
+	if err != nil {
+		c.err = err
+		return
+	}
+	last, err := columnValueKey(column, hi)
+	if err != nil {
+		c.err = err
+		return
+	}
+	c.match = func(r Row) bool {
+		k, _ := r.columnKey(column)
+		return first <= k && k <= last
+	}
+	if idx := indexOn(indexes, column); idx != nil {
+		c.useIndex(idx, first, last)
+	}
+}
+
+// whereIndex restricts the cursor to the rows whose key in
+// the index called name is between lo and hi, in index order
+func (c *Cursor) whereIndex(indexes []*index, name string, lo, hi interface{}) {
+	if c.err != nil {
+		return
+	}
+	i := findIndex(indexes, name)
+	if i < 0 {
+		c.err = ErrNoSuchIndex
+		return
+	}
+	c.where(indexes[i:i+1], indexes[i].def.Column, lo, hi)
+}
+
+// useIndex has the cursor walk the entries of idx with
+// keys from first to last, rather than every row. The
+// match filter must already be set
+func (c *Cursor) useIndex(idx *index, first, last string) {
+	c.it = idx.tree.seek(first)
+	c.last = last
+	for i, r := range c.pending {
+		if c.match(r) {
+			k, _ := r.columnKey(idx.def.Column)
+			c.pendingEntries = append(c.pendingEntries, indexEntry{
+				key:    k,
+				rowNum: c.end + uint(i),
+			})
+		}
+	}
+	sort.Slice(c.pendingEntries, func(i, j int) bool {
+		return c.pendingEntries[i].less(c.pendingEntries[j])
+	})
+}
+
+// columnValueKey returns the index key of value,
+// which must be of the type of column
+func columnValueKey(column string, value interface{}) (string, error) {
+	if _, isInt := value.(int64); isInt != IsInteger(column) {
+		return "", ErrTypeMismatch
+	}
+	return encodeKey(value)
+}
+
+// Next advances the cursor to the next row, which
+// is then available through Row. It returns false
+// when there are no more rows or an error occurred
+func (c *Cursor) Next() bool {
+	for !c.closed && c.err == nil {
+		if err := c.ctx.Err(); err != nil {
+			c.err = err
+			return false
+		}
+		r, ok, err := c.advance()
+		if err != nil {
+			c.err = err
+			return false
+		}
+		if !ok {
+			return false
+		}
+		if c.match == nil || c.match(r) {
+			c.row = r
+			return true
+		}
+	}
+	return false
+}
+
+// advance reads the next row that may be returned,
+// or reports false if there are no more
+func (c *Cursor) advance() (Row, bool, error) {
+	if c.it != nil {
+		e, ok := c.nextEntry()
+		if !ok {
+			return Row{}, false, nil
+		}
+		r, err := c.rowAt(e.rowNum)
+		return r, err == nil, err
+	}
+	if c.rowNum >= c.numRows() {
+		return Row{}, false, nil
+	}
+	r, err := c.rowAt(c.rowNum)
+	if err != nil {
+		return Row{}, false, err
+	}
+	c.rowNum += 1
+	return r, true, nil
+}
+
+// nextEntry returns the next index entry, be it
+// of a committed row or of a pending one
+func (c *Cursor) nextEntry() (indexEntry, bool) {
+	if !c.headPeeked {
+		c.head, c.headOk = c.it.next()
+		c.headOk = c.headOk && c.head.key <= c.last
+		c.headPeeked = true
+	}
+	if len(c.pendingEntries) > 0 && (!c.headOk || c.pendingEntries[0].less(c.head)) {
+		e := c.pendingEntries[0]
+		c.pendingEntries = c.pendingEntries[1:]
+		return e, true
+	}
+	if !c.headOk {
+		return indexEntry{}, false
+	}
+	c.headPeeked = false
+	return c.head, true
+}
+
+// numRows is the number of rows visible to the cursor
+func (c *Cursor) numRows() uint {
+	return c.end + uint(len(c.pending))
+}
+
+// rowAt reads the row at position rowNum
+func (c *Cursor) rowAt(rowNum uint) (Row, error) {
+	if rowNum >= c.end {
+		return c.pending[rowNum-c.end], nil
+	}
+	pageNum, indexInPage := getRowLocation(rowNum)
+	// holding mu keeps a restore from replacing
+	// the page while it is read
+	c.t.mu.RLock()
+	defer c.t.mu.RUnlock()
+	if c.t.restores != c.restores {
+		return Row{}, ErrRestored
+	}
+	p, err := c.t.p.getPage(pageNum)
+	if err != nil {
+		return Row{}, err
+	}
+	if c.pagesRead == 0 || pageNum != c.lastPage {
+		c.pagesRead += 1
+		c.lastPage = pageNum
+	}
+	return readFromPage(p, indexInPage), nil
+}
+
+// PagesRead returns how many pages the cursor
+// has read rows from so far. Going back to the
+// page it read last doesn't count again
+func (c *Cursor) PagesRead() int {
+	return c.pagesRead
+}
+
+// Row returns the row the cursor is currently on
+func (c *Cursor) Row() Row {
+	return c.row
+}
+
+// Err returns the error, if any, that stopped
+// the cursor
+func (c *Cursor) Err() error {
+	return c.err
+}
+
+// Close stops the cursor. Next returns false
+// on a closed cursor
+func (c *Cursor) Close() error {
+	c.closed = true
+	return nil
+}
+
+// SeekId positions the cursor so that the next call to Next
+// returns the row with the given id, after which the cursor
+// carries on in insertion order. The row is found through
+// the primary key. SeekId reports whether such a row exists;
+// if it doesn't the cursor is exhausted
+func (c *Cursor) SeekId(id int64) bool {
+	if c.closed || c.err != nil {
+		return false
+	}
+	if err := c.ctx.Err(); err != nil {
+		c.err = err
+		return false
+	}
+	// carry on in insertion order
+	// rather than through an index
+	c.it = nil
+	c.pendingEntries = nil
+	key, err := encodeKey(id)
+	if err != nil {
+		c.err = err
+		return false
+	}
+	it := c.indexes[0].tree.seek(key)
+	if e, ok := it.next(); ok && e.key == key && e.rowNum < c.end {
+		c.rowNum = e.rowNum
+		return true
+	}
+	// the rows of the transaction
+	// are not in the index
+	for i, r := range c.pending {
+		if r.Id == id {
+			c.rowNum = c.end + uint(i)
+			return true
+		}
+	}
+	c.rowNum = c.numRows()
+	return false
+}
@@ -0,0 +1,160 @@
+package table
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+var ErrNoSuchPage = errors.New("no such page")
+
+// PageInfo describes a page of the database file
+type PageInfo struct {
+	Num uint
+	// Type is "data" for pages of rows
+	// and "meta" for the meta page
+	Type string
+	// Used is how many bytes of the page hold data
+	// and Free how many more the page can take
+	Used, Free int
+}
+
+// Fill returns how full the page is, from 0 to 1
+func (pi PageInfo) Fill() float64 {
+	return float64(pi.Used) / float64(pi.Used+pi.Free)
+}
+
+// MetaPage is the number of the meta page, which
+// comes after room for every page of rows
+const MetaPage = maxNumPages
+
+// Pages describes the pages that hold committed
+// rows, followed by the meta page
+func (t *Table) Pages() ([]PageInfo, error) {
+	snap, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	pages := []PageInfo{}
+	for num := uint(0); num*rowsPerPage < snap.numRows; num++ {
+		rows := snap.numRows - num*rowsPerPage
+		if rows > rowsPerPage {
+			rows = rowsPerPage
+		}
+		pages = append(pages, PageInfo{
+			Num:  num,
+			Type: "data",
+			Used: int(rows * rowSize),
+			Free: int((rowsPerPage - rows) * rowSize),
+		})
+	}
+	meta, err := t.p.readMetaPage()
+	if err != nil {
+		return nil, err
+	}
+	used := metaHeaderSize + int(binary.LittleEndian.Uint32(meta[24:28]))
+	if _, summed := isMeta(meta[:]); summed {
+		// the checksums fill the end of the page
+		used += pageSize - pageSumsOffset
+	}
+	pages = append(pages, PageInfo{
+		Num:  MetaPage,
+		Type: "meta",
+		Used: used,
+		Free: pageSize - used,
+	})
+	return pages, nil
+}
+
+// Page returns a copy of the page num as the pager
+// holds it. Only the committed rows of a data page
+// are copied, the rest of it is left zeroed
+func (t *Table) Page(num uint) ([]byte, error) {
+	if num == MetaPage {
+		meta, err := t.p.readMetaPage()
+		if err != nil {
+			return nil, err
+		}
+		return meta[:], nil
+	}
+	snap, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	if num*rowsPerPage >= snap.numRows {
+		return nil, ErrNoSuchPage
+	}
+	rows := snap.numRows - num*rowsPerPage
+	if rows > rowsPerPage {
+		rows = rowsPerPage
+	}
+	p, err := t.p.getPage(num)
+	if err != nil {
+		return nil, err
+	}
+	c := make([]byte, pageSize)
+	// a writer may be filling in the
+	// rest of the last page
+	copy(c, p[:rows*rowSize])
+	return c, nil
+}
+
+// readMetaPage reads the meta page off disk. It is
+// all zeros if there is none yet
+func (pag *pager) readMetaPage() (*page, error) {
+	p := new(page)
+	_, err := pag.f.ReadAt(p[:], metaOffset)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return p, nil
+}
+
+// BTreeNode describes a node of the B-tree of an index
+type BTreeNode struct {
+	// Id tells nodes apart. The root is 0
+	Id   int
+	Leaf bool
+	// Keys are the values of the indexed column
+	// of the entries of the node, and Rows the
+	// numbers of the rows they come from
+	Keys []interface{}
+	Rows []uint
+	// Children are the ids of the children
+	// of the node, nil for leaves
+	Children []int
+}
+
+// BTree describes the nodes of the index called
+// name, level by level from the root down
+func (t *Table) BTree(name string) ([]BTreeNode, error) {
+	snap, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	i := findIndex(snap.indexes, name)
+	if i < 0 {
+		return nil, ErrNoSuchIndex
+	}
+	idx := snap.indexes[i]
+	nodes := []BTreeNode{}
+	if idx.tree.root == nil {
+		return nodes, nil
+	}
+	queue := []*btreeNode{idx.tree.root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		node := BTreeNode{Id: len(nodes), Leaf: n.isLeaf()}
+		for _, e := range n.entries {
+			node.Keys = append(node.Keys, decodeKey(idx.def.Column, e.key))
+			node.Rows = append(node.Rows, e.rowNum)
+		}
+		for _, child := range n.children {
+			node.Children = append(node.Children, len(nodes)+len(queue)+1)
+			queue = append(queue, child)
+		}
+		nodes = append(nodes, node)
+	}
+	return nodes, nil
+}
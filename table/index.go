@@ -0,0 +1,310 @@
+package table
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrIndexExists = errors.New("index already exists")
+	ErrNoSuchIndex = errors.New("no such index")
+)
+
+// IndexDef describes an index on a column of the table
+type IndexDef struct {
+	Name   string `json:"name"`
+	Column string `json:"column"`
+	// Unique indexes keep two rows from having
+	// the same value in Column
+	Unique bool `json:"unique,omitempty"`
+}
+
+// PrimaryKey is the unique index on id that every
+// table has. It can't be dropped, and Indexes
+// leaves it out
+var PrimaryKey = IndexDef{Name: "users_pkey", Column: "id", Unique: true}
+
+// index is an index along with its entries for some
+// number of committed rows. Like the btree it holds,
+// an index is never modified once built
+//
+// Only the definitions of the indexes are stored in the
+// file, in the catalog. The trees live in memory: they are
+// built from every row when the table is opened, and again
+// whenever another process changes the catalog
+type index struct {
+	def  IndexDef
+	tree *btree
+}
+
+// snapshot is the state of the table as of some
+// number of committed rows
+type snapshot struct {
+	numRows uint
+	// indexes on the rows, starting
+	// with the primary key
+	indexes []*index
+	// stats gathered by the last Analyze, if any
+	stats *Stats
+	// restores is the number of restores done when
+	// the snapshot was taken. The next one drops its rows
+	restores uint64
+}
+
+// newIndexes returns the empty indexes of c
+// along with the primary key
+func newIndexes(c catalog) []*index {
+	indexes := []*index{{def: PrimaryKey, tree: &btree{}}}
+	for _, def := range c.Indexes {
+		indexes = append(indexes, &index{def: def, tree: &btree{}})
+	}
+	return indexes
+}
+
+// findIndex returns the position of the index
+// called name, or -1 if there is none
+func findIndex(indexes []*index, name string) int {
+	for i, idx := range indexes {
+		if idx.def.Name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// indexOn returns an index on column,
+// or nil if there is none
+func indexOn(indexes []*index, column string) *index {
+	for _, idx := range indexes {
+		if idx.def.Column == column {
+			return idx
+		}
+	}
+	return nil
+}
+
+// withRows returns a copy of idx that also holds
+// rows, which are the committed rows from on
+func (idx *index) withRows(rows []Row, from uint) (*index, error) {
+	tree := idx.tree
+	for i, r := range rows {
+		key, err := r.columnKey(idx.def.Column)
+		if err != nil {
+			return nil, err
+		}
+		tree = tree.insert(indexEntry{key: key, rowNum: from + uint(i)})
+	}
+	return &index{def: idx.def, tree: tree}, nil
+}
+
+// addRows returns copies of indexes that
+// also hold rows, starting at row from
+func addRows(indexes []*index, rows []Row, from uint) ([]*index, error) {
+	if len(rows) == 0 {
+		return indexes, nil
+	}
+	added := make([]*index, len(indexes))
+	for i, idx := range indexes {
+		var err error
+		if added[i], err = idx.withRows(rows, from); err != nil {
+			return nil, err
+		}
+	}
+	return added, nil
+}
+
+// Indexes returns the indexes created with CreateIndex
+func (t *Table) Indexes() ([]IndexDef, error) {
+	snap, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return indexDefs(snap.indexes), nil
+}
+
+// indexDefs returns the definitions of
+// indexes, but for the primary key
+func indexDefs(indexes []*index) []IndexDef {
+	defs := []IndexDef{}
+	for _, idx := range indexes[1:] {
+		defs = append(defs, idx.def)
+	}
+	return defs
+}
+
+// CreateIndex builds the index described by def out of the
+// committed rows and records it in the database file. From
+// then on it is kept up to date as rows are inserted. A
+// unique index fails with ErrDuplicateKey if two rows
+// already share a value
+func (t *Table) CreateIndex(ctx context.Context, def IndexDef) error {
+	if !IsColumn(def.Column) {
+		return ErrNoSuchColumn
+	}
+	if err := t.lockWriter(ctx); err != nil {
+		return err
+	}
+	defer t.unlockWriter()
+	snap := t.current()
+	if findIndex(snap.indexes, def.Name) >= 0 {
+		return ErrIndexExists
+	}
+	rows, err := t.readRows(0, snap.numRows)
+	if err != nil {
+		return err
+	}
+	idx, err := (&index{def: def, tree: &btree{}}).withRows(rows, 0)
+	if err != nil {
+		return err
+	}
+	if def.Unique && idx.tree.hasDuplicates() {
+		return ErrDuplicateKey
+	}
+	indexes := append(snap.indexes[:len(snap.indexes):len(snap.indexes)], idx)
+	return t.writeCatalog(snap.numRows, indexes, snap.stats)
+}
+
+// DropIndex removes the index called name
+func (t *Table) DropIndex(ctx context.Context, name string) error {
+	if err := t.lockWriter(ctx); err != nil {
+		return err
+	}
+	defer t.unlockWriter()
+	snap := t.current()
+	i := findIndex(snap.indexes, name)
+	if i <= 0 {
+		// the primary key can't be dropped
+		return ErrNoSuchIndex
+	}
+	indexes := append([]*index{}, snap.indexes[:i]...)
+	indexes = append(indexes, snap.indexes[i+1:]...)
+	return t.writeCatalog(snap.numRows, indexes, snap.stats)
+}
+
+// writeCatalog records indexes and stats in the database
+// file and makes them those of the table. Only the writer
+// may call it
+func (t *Table) writeCatalog(numRows uint, indexes []*index, stats *Stats) error {
+	t.mu.RLock()
+	c := catalog{Stats: stats, Restores: t.restores}
+	t.mu.RUnlock()
+	for _, idx := range indexes[1:] {
+		c.Indexes = append(c.Indexes, idx.def)
+	}
+	b, err := c.encode()
+	if err != nil {
+		return err
+	}
+	if err := t.lock.lockCommit(); err != nil {
+		return err
+	}
+	defer t.lock.unlockCommit()
+	if err := t.p.writeMeta(numRows, b); err != nil {
+		return err
+	}
+	if err := t.p.f.Sync(); err != nil {
+		return err
+	}
+	t.mu.Lock()
+	t.indexes = indexes
+	t.stats = stats
+	t.catalog = b
+	t.mu.Unlock()
+	return nil
+}
+
+// Lookup returns a cursor over the rows whose column
+// holds value. value must be an int64 for integer
+// columns and a string for the others. The rows are
+// found through an index on column if there is one,
+// and by reading every row otherwise
+func (t *Table) Lookup(ctx context.Context, column string, value interface{}) *Cursor {
+	return t.Range(ctx, column, value, value)
+}
+
+// Range returns a cursor over the rows whose column holds
+// a value between lo and hi, both included. Through an
+// index, the rows come in the order of the index, and
+// rows with the same value in insertion order
+func (t *Table) Range(ctx context.Context, column string, lo, hi interface{}) *Cursor {
+	c := t.Cursor(ctx)
+	c.where(c.indexes, column, lo, hi)
+	return c
+}
+
+// IndexScan returns a cursor over the rows whose key in the
+// index called name is between lo and hi, both included,
+// in the order of the index
+func (t *Table) IndexScan(ctx context.Context, name string, lo, hi interface{}) *Cursor {
+	c := t.Cursor(ctx)
+	c.whereIndex(c.indexes, name, lo, hi)
+	return c
+}
+
+// Scan returns a cursor over the rows whose id is
+// between from and to, both included, in id order
+func (t *Table) Scan(ctx context.Context, from, to int64) *Cursor {
+	return t.Range(ctx, "id", from, to)
+}
+
+// GetByID returns the row with the given id, and
+// whether there is one. It finds the row through
+// the primary key, which is held in memory, and
+// then reads the single page the row is on. That
+// is after OpenDb has read every row to build the
+// primary key, which it does each time
+func (t *Table) GetByID(id int64) (Row, bool, error) {
+	return firstRow(t.Lookup(context.Background(), "id", id))
+}
+
+// Lookup returns a cursor over the rows whose column holds
+// value, including the ones inserted in this transaction
+func (tx *Tx) Lookup(ctx context.Context, column string, value interface{}) *Cursor {
+	return tx.Range(ctx, column, value, value)
+}
+
+// Range returns a cursor over the rows whose column holds
+// a value between lo and hi, including the ones inserted
+// in this transaction
+func (tx *Tx) Range(ctx context.Context, column string, lo, hi interface{}) *Cursor {
+	c := tx.Cursor(ctx)
+	c.where(tx.snapshot.indexes, column, lo, hi)
+	return c
+}
+
+// IndexScan returns a cursor over the rows whose key in
+// the index called name is between lo and hi, including
+// the ones inserted in this transaction
+func (tx *Tx) IndexScan(ctx context.Context, name string, lo, hi interface{}) *Cursor {
+	c := tx.Cursor(ctx)
+	c.whereIndex(tx.snapshot.indexes, name, lo, hi)
+	return c
+}
+
+// Indexes returns the indexes created with CreateIndex, as
+// of when the transaction began
+func (tx *Tx) Indexes() []IndexDef {
+	return indexDefs(tx.snapshot.indexes)
+}
+
+// Scan returns a cursor over the rows whose id is between
+// from and to, including the ones inserted in this
+// transaction, in id order
+func (tx *Tx) Scan(ctx context.Context, from, to int64) *Cursor {
+	return tx.Range(ctx, "id", from, to)
+}
+
+// GetByID returns the row with the given id, which may
+// have been inserted in this transaction
+func (tx *Tx) GetByID(id int64) (Row, bool, error) {
+	return firstRow(tx.Lookup(context.Background(), "id", id))
+}
+
+// firstRow returns the first row of c and closes it
+func firstRow(c *Cursor) (Row, bool, error) {
+	defer c.Close()
+	if c.Next() {
+		return c.Row(), true, nil
+	}
+	return Row{}, false, c.Err()
+}
@@ -0,0 +1,145 @@
+package table
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+var (
+	ErrDatabaseLocked = errors.New("database is locked")
+)
+
+const (
+	// busyRetryInterval is how long to wait before trying
+	// again for a lock held by another process
+	busyRetryInterval = 10 * time.Millisecond
+
+	// The locks are taken on single bytes far past the
+	// end of any database file:
+	//
+	// reservedByte is locked exclusively by the writer for
+	// the whole of its transaction, which keeps out other
+	// writers but lets readers carry on.
+	reservedByte = 1 << 30
+	// sharedByte is locked shared by readers while they catch
+	// up with the rows other processes committed, and
+	// exclusively by the writer while it commits.
+	sharedByte = reservedByte + 1
+)
+
+// fileLock keeps processes that share the database file
+// from stepping on each other, using advisory locks on
+// the file.
+//
+// A process's locks are shared by all of its goroutines, so
+// fileLock also tracks how they are using them
+type fileLock struct {
+	mu sync.Mutex
+	fd uintptr
+	// number of readers of this process
+	// holding the shared byte
+	shared int
+	// noReaders is broadcast when shared drops to zero
+	noReaders *sync.Cond
+	// reserved is true while a transaction of this
+	// process is writing
+	reserved bool
+	// busyTimeout is how long to wait for another
+	// writer before giving up
+	busyTimeout time.Duration
+}
+
+func newFileLock(fd uintptr) *fileLock {
+	l := &fileLock{fd: fd}
+	l.noReaders = sync.NewCond(&l.mu)
+	return l
+}
+
+// lockShared locks the shared byte, unless this process is
+// the writer, which already keeps every other writer out.
+// It only ever waits for a commit of another process to
+// finish. The returned function gives the lock back
+func (l *fileLock) lockShared() (unlock func() error, isWriter bool, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.reserved {
+		return func() error { return nil }, true, nil
+	}
+	if l.shared == 0 {
+		if _, err := lockByte(l.fd, sharedByte, false, true); err != nil {
+			return nil, false, err
+		}
+	}
+	l.shared += 1
+	return l.unlockShared, false, nil
+}
+
+func (l *fileLock) unlockShared() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.shared -= 1
+	if l.shared > 0 {
+		return nil
+	}
+	l.noReaders.Broadcast()
+	return unlockByte(l.fd, sharedByte)
+}
+
+// lockReserved makes this process the writer. It gives up
+// with ErrDatabaseLocked if another process is writing and
+// doesn't finish within the busy timeout
+func (l *fileLock) lockReserved(ctx context.Context) error {
+	l.mu.Lock()
+	deadline := time.Now().Add(l.busyTimeout)
+	l.mu.Unlock()
+	for {
+		locked, err := lockByte(l.fd, reservedByte, true, false)
+		if err != nil {
+			return err
+		}
+		if locked {
+			break
+		}
+		if time.Now().After(deadline) {
+			return ErrDatabaseLocked
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(busyRetryInterval):
+		}
+	}
+	l.mu.Lock()
+	l.reserved = true
+	l.mu.Unlock()
+	return nil
+}
+
+func (l *fileLock) unlockReserved() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reserved = false
+	return unlockByte(l.fd, reservedByte)
+}
+
+// lockCommit keeps readers out while the writer commits.
+// Readers hold the shared byte only briefly, so it simply
+// waits for them
+func (l *fileLock) lockCommit() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// readers of this process that started before it became
+	// the writer hold the shared byte. Turning it exclusive
+	// under them would have them unlock it when they're done
+	for l.shared > 0 {
+		l.noReaders.Wait()
+	}
+	_, err := lockByte(l.fd, sharedByte, true, true)
+	return err
+}
+
+func (l *fileLock) unlockCommit() error {
+	return unlockByte(l.fd, sharedByte)
+}
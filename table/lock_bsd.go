@@ -0,0 +1,17 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package table
+
+import (
+	"syscall"
+)
+
+// POSIX record locks belong to the process. A process
+// must only open a database file once, as the Tables
+// it opens on the same file don't keep each other out,
+// and closing one of them drops the locks of all
+const (
+	fSetLock     = syscall.F_SETLK
+	fSetLockWait = syscall.F_SETLKW
+)
@@ -0,0 +1,42 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+// +build darwin dragonfly freebsd linux netbsd openbsd
+
+package table
+
+import (
+	"syscall"
+)
+
+// lockByte takes a lock on the byte at offset of the file,
+// shared or exclusive. Unless wait is set it doesn't block,
+// and reports false if someone else holds a conflicting lock
+func lockByte(fd uintptr, offset int64, exclusive, wait bool) (bool, error) {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_RDLCK,
+		Whence: 0,
+		Start:  offset,
+		Len:    1,
+	}
+	if exclusive {
+		lk.Type = syscall.F_WRLCK
+	}
+	cmd := fSetLock
+	if wait {
+		cmd = fSetLockWait
+	}
+	err := syscall.FcntlFlock(fd, cmd, &lk)
+	if err == syscall.EAGAIN || err == syscall.EACCES {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func unlockByte(fd uintptr, offset int64) error {
+	lk := syscall.Flock_t{
+		Type:   syscall.F_UNLCK,
+		Whence: 0,
+		Start:  offset,
+		Len:    1,
+	}
+	return syscall.FcntlFlock(fd, fSetLock, &lk)
+}
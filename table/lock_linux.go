@@ -0,0 +1,10 @@
+package table
+
+// Open file description locks belong to the open file
+// rather than to the process, so two Tables of the same
+// process on the same file keep each other out too.
+// syscall doesn't define these commands
+const (
+	fSetLock     = 37 // F_OFD_SETLK
+	fSetLockWait = 38 // F_OFD_SETLKW
+)
@@ -0,0 +1,15 @@
+//go:build !darwin && !dragonfly && !freebsd && !linux && !netbsd && !openbsd
+// +build !darwin,!dragonfly,!freebsd,!linux,!netbsd,!openbsd
+
+package table
+
+// There are no advisory file locks on this platform,
+// so only one process may safely use a database file
+
+func lockByte(fd uintptr, offset int64, exclusive, wait bool) (bool, error) {
+	return true, nil
+}
+
+func unlockByte(fd uintptr, offset int64) error {
+	return nil
+}
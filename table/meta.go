@@ -0,0 +1,311 @@
+package table
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// The meta page records how many rows have been committed,
+// the catalog of the database and the checksums of its
+// pages. It sits right after the largest the rows can
+// ever grow to:
+//
+//	offset	size	contents
+//	======	====	==============
+//	0		16		metaMagic
+//	16		8		number of committed rows
+//	24		4		length of the catalog
+//	28		..		catalog, as json
+//	3692	400		CRC-32 of the committed rows of each page
+//	4092	4		CRC-32 of the meta page up to here
+//
+// The row count in the meta page is what makes a commit
+// durable: rows past it are ignored. Files written before
+// the meta page existed don't have one, their rows take
+// up the whole file. Meta pages written before pages had
+// checksums start with metaMagicNoSums and stop at the
+// catalog. The next commit adds the checksums.
+//
+// Restore stages the rows it restores in the page after the
+// meta page and on, behind a copy of the meta page they go
+// with. Once that copy is on disk the restore is bound to
+// complete: whoever finds it copies the rows into place,
+// writes the meta page and cuts the staged pages off
+const (
+	metaOffset  = maxNumPages * pageSize
+	stageOffset = metaOffset + pageSize
+	metaMagic   = "simpledb meta 2\x00"
+	// metaMagicNoSums starts the meta pages
+	// of files without checksums
+	metaMagicNoSums = "simpledb meta 1\x00"
+	metaHeaderSize  = 28
+	pageSumsOffset  = metaSumOffset - 4*maxNumPages
+	metaSumOffset   = pageSize - 4
+	maxCatalogSize  = pageSumsOffset - metaHeaderSize
+)
+
+var (
+	ErrCatalogFull = errors.New("catalog does not fit in the meta page")
+	errCorruptMeta = errors.New("meta page is corrupt")
+)
+
+// catalog describes the schema objects
+// stored in the database
+type catalog struct {
+	Indexes []IndexDef `json:"indexes,omitempty"`
+	Stats   *Stats     `json:"stats,omitempty"`
+	// Restores counts the times the rows were replaced
+	// by Restore, which tells other processes that the
+	// rows they know about are gone
+	Restores uint64 `json:"restores,omitempty"`
+}
+
+func (c catalog) encode() ([]byte, error) {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return nil, err
+	}
+	if len(b) > maxCatalogSize {
+		return nil, ErrCatalogFull
+	}
+	return b, nil
+}
+
+func decodeCatalog(b []byte) (catalog, error) {
+	c := catalog{}
+	if len(b) == 0 {
+		return c, nil
+	}
+	err := json.Unmarshal(b, &c)
+	return c, err
+}
+
+// readMeta reads the number of committed rows and the
+// encoded catalog off disk. While a restore is staged
+// the rows may be half replaced, so it fails with
+// ErrDatabaseLocked until the restore is finished
+func (pag *pager) readMeta() (numRows uint, catalog []byte, err error) {
+	// the staged meta page comes along in the same read
+	buf := make([]byte, 2*pageSize)
+	n, err := pag.f.ReadAt(buf, metaOffset)
+	if err != nil && err != io.EOF {
+		return 0, nil, err
+	}
+	if n > pageSize {
+		if _, _, staged, _ := parseMeta(buf[pageSize:n]); staged {
+			return 0, nil, ErrDatabaseLocked
+		}
+		n = pageSize
+	}
+	numRows, catalog, ok, err := parseMeta(buf[:n])
+	if err != nil {
+		return 0, nil, err
+	}
+	if !ok {
+		// no meta page yet
+		fileInfo, err := pag.f.Stat()
+		if err != nil {
+			return 0, nil, err
+		}
+		size := fileInfo.Size()
+		if size > int64(maxNumRows*rowSize) {
+			return 0, nil, errCorruptMeta
+		}
+		return uint(size) / rowSize, nil, nil
+	}
+	return numRows, catalog, nil
+}
+
+// isMeta reports whether buf starts with a meta
+// page, and whether that one has checksums
+func isMeta(buf []byte) (ok, summed bool) {
+	if len(buf) < len(metaMagic) {
+		return false, false
+	}
+	switch string(buf[:len(metaMagic)]) {
+	case metaMagic:
+		return true, true
+	case metaMagicNoSums:
+		return true, false
+	}
+	return false, false
+}
+
+// parseMeta decodes the meta page in buf. It
+// reports whether buf holds a meta page at all
+func parseMeta(buf []byte) (numRows uint, catalog []byte, ok bool, err error) {
+	ok, summed := isMeta(buf)
+	if !ok || len(buf) < metaHeaderSize {
+		return 0, nil, false, nil
+	}
+	maxLen := pageSize - metaHeaderSize
+	if summed {
+		if len(buf) < pageSize || metaSum(buf) != storedMetaSum(buf) {
+			return 0, nil, true, errCorruptMeta
+		}
+		maxLen = maxCatalogSize
+	}
+	numRows = uint(binary.LittleEndian.Uint64(buf[16:24]))
+	catalogLen := int(binary.LittleEndian.Uint32(buf[24:28]))
+	if numRows > maxNumRows || catalogLen > maxLen || metaHeaderSize+catalogLen > len(buf) {
+		return 0, nil, true, errCorruptMeta
+	}
+	return numRows, buf[metaHeaderSize : metaHeaderSize+catalogLen], true, nil
+}
+
+// metaSum computes the checksum of the meta page in buf
+func metaSum(buf []byte) uint32 {
+	return crc32.ChecksumIEEE(buf[:metaSumOffset])
+}
+
+// storedMetaSum returns the checksum the
+// meta page in buf holds for itself
+func storedMetaSum(buf []byte) uint32 {
+	return binary.LittleEndian.Uint32(buf[metaSumOffset:])
+}
+
+// pageSums returns the checksums the meta
+// page in buf holds for the pages of rows
+func pageSums(buf []byte) []uint32 {
+	sums := make([]uint32, maxNumPages)
+	for i := range sums {
+		sums[i] = binary.LittleEndian.Uint32(buf[pageSumsOffset+4*i:])
+	}
+	return sums
+}
+
+// dataSums returns the checksums of the pages
+// of data, which holds numRows rows
+func dataSums(data []byte, numRows uint) []uint32 {
+	sums := make([]uint32, maxNumPages)
+	for pageNum := uint(0); pageNum*rowsPerPage < numRows; pageNum++ {
+		start := pageNum * rowsPerPage * rowSize
+		end := start + rowsPerPage*rowSize
+		if end > numRows*rowSize {
+			end = numRows * rowSize
+		}
+		sums[pageNum] = crc32.ChecksumIEEE(data[start:end])
+	}
+	return sums
+}
+
+// encodeMeta returns a meta page
+func encodeMeta(numRows uint, catalog []byte, sums []uint32) []byte {
+	buf := make([]byte, pageSize)
+	copy(buf, metaMagic)
+	binary.LittleEndian.PutUint64(buf[16:24], uint64(numRows))
+	binary.LittleEndian.PutUint32(buf[24:28], uint32(len(catalog)))
+	copy(buf[metaHeaderSize:], catalog)
+	for i, sum := range sums {
+		binary.LittleEndian.PutUint32(buf[pageSumsOffset+4*i:], sum)
+	}
+	binary.LittleEndian.PutUint32(buf[metaSumOffset:], metaSum(buf))
+	return buf
+}
+
+// writeMeta writes the meta page to disk, with the
+// checksums of the pages holding the first numRows
+// rows. Those rows must be on disk already. Rows are
+// only ever appended, so the checksums the meta page
+// on disk holds for full pages stay right, and only
+// the pages past them are read back
+func (pag *pager) writeMeta(numRows uint, catalog []byte) error {
+	if len(catalog) > maxCatalogSize {
+		return ErrCatalogFull
+	}
+	old, err := pag.readMetaPage()
+	if err != nil {
+		return err
+	}
+	sums := make([]uint32, maxNumPages)
+	from := uint(0)
+	if oldRows, _, ok, err := parseMeta(old[:]); ok && err == nil {
+		if _, summed := isMeta(old[:]); summed {
+			if oldRows > numRows {
+				oldRows = numRows
+			}
+			from = oldRows / rowsPerPage
+			copy(sums[:from], pageSums(old[:]))
+		}
+	}
+	data := make([]byte, (numRows-from*rowsPerPage)*rowSize)
+	if _, err := pag.f.ReadAt(data, int64(from*rowsPerPage*rowSize)); err != nil {
+		return err
+	}
+	copy(sums[from:], dataSums(data, numRows-from*rowsPerPage))
+	_, err = pag.f.WriteAt(encodeMeta(numRows, catalog, sums), metaOffset)
+	return err
+}
+
+// stageRestore writes data, the rows a restore puts in
+// place, past the meta page, followed by the meta page
+// that goes with them. Once it returns, the restore
+// will be finished even if this process is not around
+// to do it
+func (pag *pager) stageRestore(data []byte, numRows uint, catalog []byte) error {
+	if _, err := pag.f.WriteAt(data, stageOffset+pageSize); err != nil {
+		return err
+	}
+	if err := pag.f.Sync(); err != nil {
+		return err
+	}
+	meta := encodeMeta(numRows, catalog, dataSums(data, numRows))
+	if _, err := pag.f.WriteAt(meta, stageOffset); err != nil {
+		return err
+	}
+	return pag.f.Sync()
+}
+
+// isRestoreStaged reports whether a
+// restore is waiting to be finished
+func (pag *pager) isRestoreStaged() (bool, error) {
+	buf := make([]byte, metaHeaderSize)
+	n, err := pag.f.ReadAt(buf, stageOffset)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	_, _, staged, _ := parseMeta(buf[:n])
+	return staged, nil
+}
+
+// finishRestore copies the rows of a staged restore into
+// place and commits them. It reports whether there was
+// a restore to finish. Doing it again after a crash does
+// no harm. Only the writer holding the commit lock may
+// call it
+func (pag *pager) finishRestore() (bool, error) {
+	buf := make([]byte, pageSize)
+	n, err := pag.f.ReadAt(buf, stageOffset)
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	numRows, _, ok, err := parseMeta(buf[:n])
+	if !ok || err != nil {
+		return false, err
+	}
+	data := make([]byte, numRows*rowSize)
+	if _, err := pag.f.ReadAt(data, stageOffset+pageSize); err != nil {
+		return false, err
+	}
+	if _, err := pag.f.WriteAt(data, 0); err != nil {
+		return false, err
+	}
+	if err := pag.f.Sync(); err != nil {
+		return false, err
+	}
+	// the staged meta page holds the
+	// checksums of the rows as well
+	if _, err := pag.f.WriteAt(buf, metaOffset); err != nil {
+		return false, err
+	}
+	if err := pag.f.Sync(); err != nil {
+		return false, err
+	}
+	if err := pag.f.Truncate(stageOffset); err != nil {
+		return false, err
+	}
+	return true, pag.f.Sync()
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"sync"
 )
 
 // pager stores pages of our table on to disk. It simply
@@ -14,9 +15,14 @@ import (
 //  if it can not find a requested page in the cache
 //  it fetches it from disk
 type pager struct {
-	f        *os.File
-	fileSize int64
+	f *os.File
+	// dataSize is the number of bytes taken up on
+	// disk by the committed rows
+	dataSize int64
 
+	// mu guards dataSize and pages, as concurrent
+	// readers may fill the cache at the same time
+	mu sync.Mutex
 	// pointer to pages that contain
 	// rows of data
 	pages [maxNumPages]*page
@@ -34,13 +40,8 @@ func newPager(filename string) (*pager, error) {
 	if err != nil {
 		return nil, err
 	}
-	fileInfo, err := f.Stat()
-	if err != nil {
-		return nil, err
-	}
 	p := &pager{
-		f:        f,
-		fileSize: fileInfo.Size(),
+		f: f,
 	}
 	return p, nil
 }
@@ -49,7 +50,7 @@ func newPager(filename string) (*pager, error) {
 // database file on disk contains the
 // page pageNum
 func (pag *pager) isPageOnDisk(pageNum uint) bool {
-	numRowsOnDisk := uint(pag.fileSize) / rowSize
+	numRowsOnDisk := uint(pag.dataSize) / rowSize
 	numPagesOnDisk := numRowsOnDisk / rowsPerPage
 
 	if numRowsOnDisk%rowsPerPage != 0 {
@@ -62,11 +63,18 @@ func (pag *pager) isPageOnDisk(pageNum uint) bool {
 // index into p
 func (pag *pager) copyPageFromDisk(p *page, num uint) error {
 	actualBytesOnDiskPerPage := rowsPerPage * rowSize
+	offset := int64(num * actualBytesOnDiskPerPage)
+	// don't read past the rows we know were committed, another
+	// process may be in the middle of appending more
+	length := int64(actualBytesOnDiskPerPage)
+	if offset+length > pag.dataSize {
+		length = pag.dataSize - offset
+	}
 	n, err := pag.f.ReadAt(
-		[]byte(p[:actualBytesOnDiskPerPage]),
-		int64(num*actualBytesOnDiskPerPage),
+		[]byte(p[:length]),
+		offset,
 	)
-	if err == io.EOF {
+	if err == nil || err == io.EOF {
 		// we might have read a partial page off disk
 		if uint(n)%rowSize != 0 {
 			// sanity check: did we read a legal number of bytes?
@@ -87,6 +95,8 @@ func (pag *pager) getPage(num uint) (*page, error) {
 		panic("num > maxNumPages")
 	}
 
+	pag.mu.Lock()
+	defer pag.mu.Unlock()
 	p := pag.pages[num]
 	if p == nil {
 		// Cache miss. Allocate memory and load from file.
@@ -105,7 +115,7 @@ func (pag *pager) getPage(num uint) (*page, error) {
 }
 
 func (pag *pager) flushPartialPage(pageNum, numRows uint) error {
-	p := pag.pages[pageNum]
+	p := pag.cachedPage(pageNum)
 	if p == nil {
 		panic("asked to flush nil page to disk")
 	}
@@ -121,20 +131,20 @@ func (pag *pager) flushPage(pageNum uint) error {
 	return pag.flushPartialPage(pageNum, rowsPerPage)
 }
 
-// flushToDisk walks the cache of pages we
-// have and flushes them to disk
-func (pag *pager) flushToDisk(numRowsInTable uint) error {
+// flushRows flushes the cached pages that hold
+// rows [from, numRowsInTable) to disk. Pages that
+// were never loaded have nothing new to write
+func (pag *pager) flushRows(from, numRowsInTable uint) error {
 	numFullPages := numRowsInTable / rowsPerPage
-	for i := uint(0); i < numFullPages; i++ {
-		p := pag.pages[i]
-		if p == nil {
+	for i := from / rowsPerPage; i < numFullPages; i++ {
+		if pag.cachedPage(i) == nil {
 			continue
 		}
 		if err := pag.flushPage(i); err != nil {
 			return err
 		}
 	}
-	if numRowsInTable%rowsPerPage != 0 {
+	if numRowsInTable%rowsPerPage != 0 && pag.cachedPage(numFullPages) != nil {
 		// There is a partial page to write to
 		// the end of the file
 		// For some reason we wont need to do this
@@ -145,9 +155,63 @@ func (pag *pager) flushToDisk(numRowsInTable uint) error {
 			return err
 		}
 	}
+	return nil
+}
+
+// cachedPage returns page pageNum if it is in
+// the cache, without loading it from disk
+func (pag *pager) cachedPage(pageNum uint) *page {
+	pag.mu.Lock()
+	defer pag.mu.Unlock()
+	return pag.pages[pageNum]
+}
 
-	if err := pag.f.Close(); err != nil {
-		return err
+// refresh catches the pager up with what other processes
+// committed to the file. It returns the number of rows
+// in the file and its encoded catalog
+func (pag *pager) refresh() (uint, []byte, error) {
+	numRows, catalog, err := pag.readMeta()
+	if err != nil {
+		return 0, nil, err
 	}
-	return nil
+	pag.mu.Lock()
+	defer pag.mu.Unlock()
+	dataSize := int64(numRows * rowSize)
+	if dataSize != pag.dataSize {
+		// rows are only ever appended, so only the pages
+		// from the last partially full one onwards can
+		// be out of date
+		firstStalePage := uint(pag.dataSize) / rowSize / rowsPerPage
+		if dataSize < pag.dataSize {
+			firstStalePage = 0
+		}
+		for i := firstStalePage; i < maxNumPages; i++ {
+			pag.pages[i] = nil
+		}
+		pag.dataSize = dataSize
+	}
+	return numRows, catalog, nil
+}
+
+// invalidate empties the cache
+func (pag *pager) invalidate() {
+	pag.mu.Lock()
+	defer pag.mu.Unlock()
+	for i := range pag.pages {
+		pag.pages[i] = nil
+	}
+}
+
+// committed records that this process committed the
+// rows up to numRows. The cache holds them already
+func (pag *pager) committed(numRows uint) {
+	pag.mu.Lock()
+	defer pag.mu.Unlock()
+	pag.dataSize = int64(numRows * rowSize)
+}
+
+// close closes the database file. Everything
+// committed is on disk already
+func (pag *pager) close() error {
+	return pag.f.Close()
 }
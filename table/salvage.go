@@ -0,0 +1,163 @@
+package table
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"unicode/utf8"
+)
+
+// Salvaged is what Salvage got out of a damaged file
+type Salvaged struct {
+	Rows []Row
+	// Indexes are the indexes of the catalog
+	// that the rows still satisfy
+	Indexes []IndexDef
+	// Problems describe the pages, rows and
+	// indexes that were skipped, and why
+	Problems []string
+}
+
+// Salvage reads the database file at path on a best effort
+// basis, without opening it as a Table, and returns every
+// row that decodes cleanly.
+//
+// The row count and catalog are taken from the meta page
+// when it can be read. Otherwise every page that fits
+// before the meta page is scanned, up to as many rows as
+// the table can hold, and rows that are all zeros are
+// taken to be unused. Of rows with the same id, only the
+// first is kept
+func Salvage(path string) (*Salvaged, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fileInfo, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	size := fileInfo.Size()
+	s := &Salvaged{Rows: []Row{}, Indexes: []IndexDef{}}
+	report := func(format string, args ...interface{}) {
+		s.Problems = append(s.Problems, fmt.Sprintf(format, args...))
+	}
+
+	pag := &pager{f: f}
+	meta, err := pag.readMetaPage()
+	if err != nil {
+		return nil, err
+	}
+	// known is whether the meta page tells
+	// how many rows there are
+	known := false
+	var numRows uint
+	var b []byte
+	if ok, _ := isMeta(meta[:]); !ok {
+		report("meta page: missing, scanning every page")
+	} else if numRows, b, err = pag.readMeta(); err != nil {
+		report("meta page: %s, scanning every page", err)
+	} else {
+		known = true
+	}
+	c, err := decodeCatalog(b)
+	if err != nil {
+		report("meta page: catalog does not decode, the indexes are lost: %s", err)
+	}
+	if !known {
+		end := size
+		if end > metaOffset {
+			end = metaOffset
+		}
+		numRows = uint(end) / rowSize
+		if uint(end)%rowSize != 0 {
+			// keep the partial row to report it
+			numRows += 1
+		}
+		if numRows > maxNumRows {
+			// a table never holds more rows, so
+			// anything past them is not a row
+			numRows = maxNumRows
+			rest := make([]byte, end-int64(maxNumRows*rowSize))
+			read, _ := f.ReadAt(rest, int64(maxNumRows*rowSize))
+			if len(bytes.Trim(rest[:read], "\x00")) != 0 {
+				report("past row %d: skipped, the table holds at most %d rows", maxNumRows-1, maxNumRows)
+			}
+		}
+	}
+
+	ids := map[int64]uint{}
+	buf := make([]byte, rowsPerPage*rowSize)
+	for pageNum := uint(0); pageNum*rowsPerPage < numRows; pageNum++ {
+		n := numRows - pageNum*rowsPerPage
+		if n > rowsPerPage {
+			n = rowsPerPage
+		}
+		read, err := f.ReadAt(buf[:n*rowSize], int64(pageNum*rowsPerPage*rowSize))
+		if err != nil && err != io.EOF {
+			report("page %d: skipped, %s", pageNum, err)
+			continue
+		}
+		if uint(read) < n*rowSize {
+			report("page %d: truncated, %d of its %d rows are missing",
+				pageNum, n-uint(read)/rowSize, n)
+			n = uint(read) / rowSize
+		}
+		var p page
+		copy(p[:], buf[:n*rowSize])
+		for i := uint(0); i < n; i++ {
+			rowNum := pageNum*rowsPerPage + i
+			row := p[i*rowSize : (i+1)*rowSize]
+			if !known && len(bytes.Trim(row, "\x00")) == 0 {
+				continue
+			}
+			r := readFromPage(&p, i)
+			if problem := rowProblem(r); problem != "" {
+				report("page %d: skipped row %d, %s", pageNum, rowNum, problem)
+				continue
+			}
+			if first, ok := ids[r.Id]; ok {
+				report("page %d: skipped row %d, its id %d is that of row %d", pageNum, rowNum, r.Id, first)
+				continue
+			}
+			ids[r.Id] = rowNum
+			s.Rows = append(s.Rows, r)
+		}
+	}
+
+	for _, def := range c.Indexes {
+		if !IsColumn(def.Column) {
+			report("index %s: skipped, no such column %s", def.Name, def.Column)
+			continue
+		}
+		idx, err := (&index{def: def, tree: &btree{}}).withRows(s.Rows, 0)
+		if err != nil {
+			report("index %s: skipped, %s", def.Name, err)
+			continue
+		}
+		if def.Unique && idx.tree.hasDuplicates() {
+			report("index %s: skipped, rows share a key", def.Name)
+			continue
+		}
+		s.Indexes = append(s.Indexes, def)
+	}
+	return s, nil
+}
+
+// rowProblem tells what keeps r from
+// being a row the table could have written
+func rowProblem(r Row) string {
+	switch {
+	case r.Id < 0:
+		return "its id is negative"
+	case !zeroPadded(r.Username[:]):
+		return "its username has bytes after its end"
+	case !zeroPadded(r.Email[:]):
+		return "its email has bytes after its end"
+	case !utf8.Valid(r.Username[:]) || !utf8.Valid(r.Email[:]):
+		return "it is not valid text"
+	}
+	return ""
+}
@@ -0,0 +1,158 @@
+package table
+
+import (
+	"context"
+	"sort"
+)
+
+const (
+	// histogramBuckets is how many buckets the
+	// histogram of each column has at most
+	histogramBuckets = 8
+	// histogramKeySize is how much of a key the
+	// histogram keeps, to keep the catalog small
+	histogramKeySize = 16
+)
+
+// Stats describe the rows of the table as they were when
+// Analyze last ran. The planner uses them to estimate
+// how many rows a query will read
+type Stats struct {
+	NumRows uint          `json:"rows"`
+	Columns []ColumnStats `json:"columns"`
+}
+
+// ColumnStats describe the values of a column
+type ColumnStats struct {
+	Column string `json:"column"`
+	// Distinct is the number of different values
+	Distinct uint `json:"distinct"`
+	// Bounds are the bounds of an equi-depth histogram
+	// of the values: about as many rows fall between
+	// each pair of consecutive bounds. They are index
+	// keys cut down to their first few bytes
+	Bounds [][]byte `json:"bounds"`
+}
+
+// computeStats gathers the statistics of rows
+func computeStats(rows []Row) *Stats {
+	s := &Stats{NumRows: uint(len(rows))}
+	keys := make([]string, len(rows))
+	for _, c := range Columns {
+		for i, r := range rows {
+			keys[i], _ = r.columnKey(c.Name)
+		}
+		sort.Strings(keys)
+		cs := ColumnStats{Column: c.Name}
+		for i, k := range keys {
+			if i == 0 || k != keys[i-1] {
+				cs.Distinct += 1
+			}
+		}
+		if len(keys) > 0 {
+			buckets := histogramBuckets
+			if len(keys)-1 < buckets {
+				buckets = len(keys) - 1
+			}
+			if buckets == 0 {
+				buckets = 1
+			}
+			for i := 0; i <= buckets; i++ {
+				bound := truncateKey(keys[i*(len(keys)-1)/buckets])
+				cs.Bounds = append(cs.Bounds, []byte(bound))
+			}
+		}
+		s.Columns = append(s.Columns, cs)
+	}
+	return s
+}
+
+func truncateKey(key string) string {
+	if len(key) > histogramKeySize {
+		return key[:histogramKeySize]
+	}
+	return key
+}
+
+// Pages returns how many pages the rows take up
+func (s *Stats) Pages() float64 {
+	return float64((s.NumRows + rowsPerPage - 1) / rowsPerPage)
+}
+
+// Estimate returns how many rows are expected to hold a
+// value of column between lo and hi. A single value is
+// expected to be shared by as many rows as any other, a
+// range to hold as many rows as the buckets of the
+// histogram it covers
+func (s *Stats) Estimate(column string, lo, hi interface{}) float64 {
+	var cs *ColumnStats
+	for i := range s.Columns {
+		if s.Columns[i].Column == column {
+			cs = &s.Columns[i]
+		}
+	}
+	if cs == nil || cs.Distinct == 0 {
+		return float64(s.NumRows)
+	}
+	first, err := columnValueKey(column, lo)
+	if err != nil {
+		return float64(s.NumRows)
+	}
+	last, err := columnValueKey(column, hi)
+	if err != nil {
+		return float64(s.NumRows)
+	}
+	if first == last {
+		return float64(s.NumRows) / float64(cs.Distinct)
+	}
+	first, last = truncateKey(first), truncateKey(last)
+	buckets := len(cs.Bounds) - 1
+	covered := 0.0
+	for i := 0; i < buckets; i++ {
+		lower, upper := string(cs.Bounds[i]), string(cs.Bounds[i+1])
+		switch {
+		case upper < first || lower > last:
+			// outside of the range
+		case first <= lower && upper <= last:
+			covered += 1
+		default:
+			// partly in the range
+			covered += 0.5
+		}
+	}
+	return float64(s.NumRows) * covered / float64(buckets)
+}
+
+// Stats returns the statistics gathered by the last
+// Analyze, or nil if it never ran
+func (t *Table) Stats() (*Stats, error) {
+	snap, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return snap.stats, nil
+}
+
+// Stats returns the statistics gathered by the last
+// Analyze as of when the transaction began
+func (tx *Tx) Stats() *Stats {
+	return tx.snapshot.stats
+}
+
+// Analyze gathers statistics about the committed rows
+// and records them in the database file
+func (t *Table) Analyze(ctx context.Context) error {
+	if err := t.lockWriter(ctx); err != nil {
+		return err
+	}
+	defer t.unlockWriter()
+	snap := t.current()
+	rows, err := t.readRows(0, snap.numRows)
+	if err != nil {
+		return err
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return t.writeCatalog(snap.numRows, snap.indexes, computeStats(rows))
+}
@@ -2,15 +2,14 @@ package table
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
 	"errors"
-	"io"
-	"log"
+	"sync"
+	"time"
 	"unsafe"
 )
 
-// Table is not thread safe!
-
 // Table implements the append-only single in-memory Table that
 // consists of rows of entries:
 //		column			type
@@ -38,16 +37,50 @@ const (
 	maxNumPages = 100
 	rowSize     = uint(unsafe.Sizeof(Row{})) // is 296
 	rowsPerPage = pageSize / rowSize         // is 13
+	maxNumRows  = maxNumPages * rowsPerPage
 )
 
 type page [pageSize]byte
 
 // Table is an instance of our in-memory append-only
 // table with just one schema
+//
+// Table is safe for concurrent use by multiple goroutines.
+// Any number of them may read at the same time, while
+// only one transaction at a time may write. Readers
+// never wait for the writer: each of them reads from a
+// snapshot of the rows that were committed when it
+// started, and a commit only ever adds rows past the
+// end of every snapshot. A row is never changed once
+// written, so rows carry no versions
 type Table struct {
-	// current number of rows in Table
+	// mu guards nextFreeRow, indexes, numIndexed,
+	// stats, catalog and restores
+	mu sync.RWMutex
+	// current number of committed rows in Table.
+	// Rows past it may be in the middle of being
+	// written by a commit
 	nextFreeRow uint
 	p           *pager
+
+	// indexes hold the first numIndexed committed
+	// rows. The primary key comes first
+	indexes    []*index
+	numIndexed uint
+	stats      *Stats
+	// catalog is the encoded catalog that indexes
+	// and stats were read from
+	catalog []byte
+	// restores is the number of restores
+	// recorded in catalog
+	restores uint64
+
+	// writer is held by the transaction that
+	// is currently writing to the table
+	writer chan struct{}
+	// lock coordinates with other processes
+	// that opened the same file
+	lock *fileLock
 }
 
 // OpenDb opens a connection to the database
@@ -58,19 +91,188 @@ func OpenDb(filename string) (*Table, error) {
 		return nil, err
 	}
 	t := &Table{
-		p:           p,
-		nextFreeRow: uint(p.fileSize) / rowSize,
+		p:       p,
+		writer:  make(chan struct{}, 1),
+		lock:    newFileLock(p.f.Fd()),
+		indexes: newIndexes(catalog{}),
+	}
+	if staged, err := p.isRestoreStaged(); err != nil || staged {
+		// readers can't use the file until
+		// the restore is finished
+		if err == nil {
+			err = t.lockWriter(context.Background())
+		}
+		if err != nil {
+			p.close()
+			return nil, err
+		}
+		t.unlockWriter()
+	}
+	if _, err := t.snapshot(); err != nil {
+		p.close()
+		return nil, err
 	}
 	return t, nil
 }
 
-// CloseDb flushes the database to disk
+// CloseDb closes the database. Rows are written
+// to disk as they are committed, so there is
+// nothing left to flush
 func (t *Table) CloseDb() error {
-	return t.p.flushToDisk(t.nextFreeRow)
+	return t.p.close()
+}
+
+// SetBusyTimeout sets how long to wait for another
+// process that is using the database file before
+// giving up with ErrDatabaseLocked. The default is
+// not to wait at all
+func (t *Table) SetBusyTimeout(d time.Duration) {
+	t.lock.mu.Lock()
+	defer t.lock.mu.Unlock()
+	t.lock.busyTimeout = d
+}
+
+// snapshot returns the state of the committed rows, after
+// catching up with what other processes committed
+func (t *Table) snapshot() (snapshot, error) {
+	unlock, isWriter, err := t.lock.lockShared()
+	if err != nil {
+		return snapshot{}, err
+	}
+	defer unlock()
+	// if this process is the writer, nobody else could
+	// have written, and the rows our own writer is
+	// committing must stay hidden
+	if !isWriter {
+		if err := t.refresh(); err != nil {
+			return snapshot{}, err
+		}
+	}
+	return t.current(), nil
+}
+
+// current returns the state of the committed
+// rows this process knows about
+func (t *Table) current() snapshot {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return snapshot{
+		numRows:  t.nextFreeRow,
+		indexes:  t.indexes,
+		stats:    t.stats,
+		restores: t.restores,
+	}
+}
+
+// refresh catches up with the rows and indexes other
+// processes committed. The caller must hold a file lock
+func (t *Table) refresh() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	n, cat, err := t.p.refresh()
+	if err != nil {
+		return err
+	}
+	if n < t.numIndexed || !bytes.Equal(cat, t.catalog) {
+		// the file shrank or the indexes changed,
+		// build them all again
+		c, err := decodeCatalog(cat)
+		if err != nil {
+			return err
+		}
+		t.indexes = newIndexes(c)
+		t.numIndexed = 0
+		t.stats = c.Stats
+		t.catalog = cat
+		if c.Restores != t.restores {
+			// every row may have changed
+			t.p.invalidate()
+			t.restores = c.Restores
+		}
+	}
+	rows, err := t.readRows(t.numIndexed, n)
+	if err != nil {
+		return err
+	}
+	indexes, err := addRows(t.indexes, rows, t.numIndexed)
+	if err != nil {
+		return err
+	}
+	t.indexes = indexes
+	t.numIndexed = n
+	t.nextFreeRow = n
+	return nil
+}
+
+// readRows reads the committed rows [from, to)
+func (t *Table) readRows(from, to uint) ([]Row, error) {
+	rows := make([]Row, 0, to-from)
+	for rowNum := from; rowNum < to; rowNum++ {
+		pageNum, indexInPage := getRowLocation(rowNum)
+		p, err := t.p.getPage(pageNum)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, readFromPage(p, indexInPage))
+	}
+	return rows, nil
+}
+
+// numRows returns the number of committed rows
+func (t *Table) numRows() uint {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return t.nextFreeRow
+}
+
+// lockWriter waits until no other transaction of this
+// process is writing to the table, or until ctx is done.
+// It then locks other processes out of the file and
+// catches up with what they committed
+func (t *Table) lockWriter(ctx context.Context) error {
+	select {
+	case t.writer <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if err := t.lock.lockReserved(ctx); err != nil {
+		<-t.writer
+		return err
+	}
+	if err := t.finishRestore(); err != nil {
+		t.unlockWriter()
+		return err
+	}
+	if err := t.refresh(); err != nil {
+		t.unlockWriter()
+		return err
+	}
+	return nil
+}
+
+// finishRestore finishes a restore that was cut short.
+// Only the writer may call it
+func (t *Table) finishRestore() error {
+	if staged, err := t.p.isRestoreStaged(); err != nil || !staged {
+		return err
+	}
+	if err := t.lock.lockCommit(); err != nil {
+		return err
+	}
+	defer t.lock.unlockCommit()
+	_, err := t.p.finishRestore()
+	return err
+}
+
+// unlockWriter lets the next transaction write
+func (t *Table) unlockWriter() {
+	t.lock.unlockReserved()
+	<-t.writer
 }
 
 var (
-	ErrTableFull = errors.New("table full")
+	ErrTableFull    = errors.New("table full")
+	ErrDuplicateKey = errors.New("duplicate key")
 )
 
 // insertIntoPage marshals r into p as the indexInPage element
@@ -99,89 +301,47 @@ func getRowLocation(rowNum uint) (pageNum, indexInPage uint) {
 	return
 }
 
-// Insert tries to insert into the Table
-func (t *Table) Insert(r Row) error {
-	pageNum, indexInPage := getRowLocation(t.nextFreeRow)
+// Insert tries to insert into the Table. The row is
+// committed straight away, as if in a transaction
+// of its own
+func (t *Table) Insert(ctx context.Context, r Row) error {
+	tx, err := t.Begin()
+	if err != nil {
+		return err
+	}
+	if err := tx.Insert(ctx, r); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeRow writes r into the page cache as the
+// rowNum'th row of the Table. Only the transaction
+// holding the writer lock may call it
+func (t *Table) writeRow(rowNum uint, r Row) error {
+	pageNum, indexInPage := getRowLocation(rowNum)
 	if pageNum >= maxNumPages {
 		return ErrTableFull
 	}
 	p, err := t.p.getPage(pageNum)
-	log.Printf("got page to insert into at address %p", p)
 	if err != nil {
 		return err
 	}
 	insertIntoPage(p, r, indexInPage)
-	t.nextFreeRow += 1
 	return nil
 }
 
-// readPage reads Rows off p and emits them to c
-func readPage(p *page, c chan<- GetRowsResult) {
-
-	bArray := [pageSize]byte(*p)
-	bSlice := bArray[:]
-	bReader := bytes.NewReader(bSlice)
-	r := &Row{}
-	emptyRow := Row{}
-	var numRead uint = 0
-	for {
-		if numRead > rowsPerPage {
-			break
-		}
-		err := binary.Read(bReader, binary.LittleEndian, r)
-		if err == io.ErrUnexpectedEOF ||
-			// empty row means we hit end of contents on this page
-			*r == emptyRow {
-			break
-		}
-		if err != nil {
-			panic(err)
-		}
-		c <- GetRowsResult{
-			nil,
-			*r,
-		}
-		numRead += 1
+// readFromPage unmarshals the indexInPage element of p
+func readFromPage(p *page, indexInPage uint) Row {
+	r := Row{}
+	err := binary.Read(
+		bytes.NewReader(p[indexInPage*rowSize:(indexInPage+1)*rowSize]),
+		binary.LittleEndian,
+		&r,
+	)
+	if err != nil {
+		panic("failed to unmarshal row")
 	}
-	return
-}
-
-type GetRowsResult struct {
-	Err error
-	Row Row
-}
-
-func (t *Table) lastPageIsPartiallyFull() bool {
-	return t.nextFreeRow%rowsPerPage != 0
-}
-
-// GetRows provides a handle that emits all rows present
-// in insertion order
-func (t *Table) GetRows() <-chan GetRowsResult {
-	c := make(chan GetRowsResult)
-	go func() {
-		numPagesInTable := t.nextFreeRow / rowsPerPage
-		log.Printf("numPagesInTable=%d", numPagesInTable)
-		if t.lastPageIsPartiallyFull() {
-			log.Printf("partial page! increased number numPagesInTable=%d", numPagesInTable)
-			numPagesInTable += 1
-		}
-
-		for i := uint(0); i < numPagesInTable; i += 1 {
-			p, err := t.p.getPage(i)
-			if err != nil {
-				c <- GetRowsResult{
-					err,
-					Row{},
-				}
-				close(c)
-				return
-			}
-			// readPage knows to stop reading a partial page
-			log.Printf("asking to read pageNum %d", i)
-			readPage(p, c)
-		}
-		close(c)
-	}()
-	return c
+	return r
 }
@@ -1,10 +1,19 @@
 package table_test
 
 import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"github.com/sussadag/lets-build-a-simple-db/table"
 	"log"
+	"math/rand"
 	"os"
+	"runtime"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 )
 
 func TestInsertOneRow(t *testing.T) {
@@ -33,20 +42,22 @@ func TestInsertOneRow(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
-	err = tab.Insert(r)
+	err = tab.Insert(context.Background(), r)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	for i := range tab.GetRows() {
-		if i.Err != nil {
-			t.Fatal(i.Err)
-		}
-		if r != i.Row {
-			t.Logf("Got '% x', sent '% x'", i.Row, r)
+	c := tab.Cursor(context.Background())
+	defer c.Close()
+	for c.Next() {
+		if r != c.Row() {
+			t.Logf("Got '% x', sent '% x'", c.Row(), r)
 			t.Fatalf("Did not get what we put in")
 		}
 	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
 }
 
 func TestInsertIntoTwoPages(t *testing.T) {
@@ -72,6 +83,7 @@ func TestInsertIntoTwoPages(t *testing.T) {
 	numRows := 20
 	for i := 1; i <= numRows; i++ {
 		err := tab.Insert(
+			context.Background(),
 			table.Row{
 				Id:       int64(i),
 				Username: nameArr,
@@ -84,11 +96,10 @@ func TestInsertIntoTwoPages(t *testing.T) {
 	}
 
 	out := int64(1)
-	for i := range tab.GetRows() {
-		if i.Err != nil {
-			log.Fatal(i.Err)
-		}
-		r2 := i.Row
+	c := tab.Cursor(context.Background())
+	defer c.Close()
+	for c.Next() {
+		r2 := c.Row()
 		if r2.Id != out {
 			t.Fatalf(
 				"Unexpected value. "+
@@ -98,9 +109,1313 @@ func TestInsertIntoTwoPages(t *testing.T) {
 		}
 		out += 1
 	}
+	if err := c.Err(); err != nil {
+		log.Fatal(err)
+	}
 	if int(out-1) != numRows {
 		t.Fatalf(
 			"Failed to get back %d rows, only got %d",
 			numRows, out)
 	}
 }
+
+func makeRow(id int64, username, email string) table.Row {
+	r := table.Row{Id: id}
+	copy(r.Username[:], username)
+	copy(r.Email[:], email)
+	return r
+}
+
+func TestCursorStopsEarly(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		if err := tab.Insert(context.Background(), makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := tab.Cursor(context.Background())
+	for i := 1; i <= 3; i++ {
+		if !c.Next() {
+			t.Fatalf("cursor ended after %d rows", i-1)
+		}
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if c.Next() {
+		t.Fatalf("closed cursor returned row '%+v'", c.Row())
+	}
+}
+
+func TestCursorSeek(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		if err := tab.Insert(context.Background(), makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c := tab.Cursor(context.Background())
+	defer c.Close()
+	if !c.SeekId(15) {
+		t.Fatal("did not find row with id 15")
+	}
+	out := int64(15)
+	for c.Next() {
+		if c.Row().Id != out {
+			t.Fatalf("Expected row with id %d, got row '%+v'", out, c.Row())
+		}
+		out += 1
+	}
+	if out != 21 {
+		t.Fatalf("Expected to stop after id 20, stopped after %d", out-1)
+	}
+
+	if c.SeekId(42) {
+		t.Fatal("found row with id 42 that was never inserted")
+	}
+	if c.Next() {
+		t.Fatalf("cursor returned row '%+v' after failed seek", c.Row())
+	}
+
+	// the row is found through the primary key,
+	// without reading the page before its own
+	c = tab.Cursor(context.Background())
+	defer c.Close()
+	if !c.SeekId(15) || !c.Next() || c.Row().Id != 15 {
+		t.Fatal("did not find row with id 15")
+	}
+	if n := c.PagesRead(); n != 1 {
+		t.Fatalf("Expected to read 1 page, read %d", n)
+	}
+
+	// rows of a transaction are found too
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tx.Rollback()
+	if err := tx.Insert(context.Background(), makeRow(42, "lala", "lala@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	c = tx.Cursor(context.Background())
+	defer c.Close()
+	if !c.SeekId(42) || !c.Next() || c.Row().Id != 42 {
+		t.Fatal("did not find row with id 42 inserted in the transaction")
+	}
+}
+
+func TestCursorCancel(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 1; i <= 20; i++ {
+		if err := tab.Insert(context.Background(), makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c := tab.Cursor(ctx)
+	defer c.Close()
+	numRead := 0
+	for c.Next() {
+		numRead += 1
+		if numRead == 5 {
+			cancel()
+		}
+	}
+	if c.Err() != context.Canceled {
+		t.Fatalf("Expected '%s', got '%v'", context.Canceled, c.Err())
+	}
+	if numRead != 5 {
+		t.Fatalf("Expected cursor to stop after 5 rows, got %d", numRead)
+	}
+
+	if err := tab.Insert(ctx, makeRow(21, "sush", "sush@lala.com")); err != context.Canceled {
+		t.Fatalf("Expected '%s', got '%v'", context.Canceled, err)
+	}
+}
+
+func TestTxCommit(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := tab.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 20; i++ {
+		if err := tx.Insert(ctx, makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 1 {
+		t.Fatalf("Uncommitted rows are visible outside the transaction: got %d rows", n)
+	}
+	if n := countRows(t, tx.Cursor(ctx)); n != 20 {
+		t.Fatalf("Transaction should see its own rows: got %d rows", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 20 {
+		t.Fatalf("Expected 20 rows after commit, got %d", n)
+	}
+	if err := tx.Insert(ctx, makeRow(21, "sush", "sush@lala.com")); err != table.ErrTxDone {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrTxDone, err)
+	}
+
+	// committed rows are on disk without closing the table
+	tab2, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab2.Cursor(ctx)); n != 20 {
+		t.Fatalf("Expected 20 rows on disk after commit, got %d", n)
+	}
+}
+
+func TestTxRollback(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := tab.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 2; i <= 20; i++ {
+		if err := tx.Insert(ctx, makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 1 {
+		t.Fatalf("Expected 1 row after rollback, got %d", n)
+	}
+	if err := tx.Commit(); err != table.ErrTxDone {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrTxDone, err)
+	}
+}
+
+// countRows drains c and returns the number of rows it saw
+func countRows(t *testing.T, c *table.Cursor) int {
+	defer c.Close()
+	n := 0
+	for c.Next() {
+		n += 1
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return n
+}
+
+func TestTxSavepoints(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	insert := func(from, to int) {
+		for i := from; i <= to; i++ {
+			if err := tx.Insert(ctx, makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	insert(1, 5)
+	if err := tx.Savepoint("batch"); err != nil {
+		t.Fatal(err)
+	}
+	insert(6, 10)
+	if err := tx.Savepoint("inner"); err != nil {
+		t.Fatal(err)
+	}
+	insert(11, 15)
+	if err := tx.RollbackTo("batch"); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tx.Cursor(ctx)); n != 5 {
+		t.Fatalf("Expected 5 rows after rolling back to savepoint, got %d", n)
+	}
+	if err := tx.RollbackTo("inner"); err != table.ErrNoSavepoint {
+		t.Fatalf("Expected '%s' for savepoint set after 'batch', got '%v'", table.ErrNoSavepoint, err)
+	}
+
+	// the savepoint survives being rolled back to
+	insert(6, 8)
+	if err := tx.RollbackTo("batch"); err != nil {
+		t.Fatal(err)
+	}
+	insert(6, 7)
+	if err := tx.Release("batch"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Release("batch"); err != table.ErrNoSavepoint {
+		t.Fatalf("Expected '%s' for released savepoint, got '%v'", table.ErrNoSavepoint, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 7 {
+		t.Fatalf("Expected 7 rows after commit, got %d", n)
+	}
+}
+
+// Run with `go test -race` to catch unsynchronized access
+func TestConcurrentInsertsAndScans(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	numWriters, rowsPerWriter := 4, 50
+
+	var wg sync.WaitGroup
+	errs := make(chan error, numWriters*rowsPerWriter)
+	for w := 0; w < numWriters; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < rowsPerWriter; i++ {
+				id := int64(w*rowsPerWriter + i + 1)
+				if err := tab.Insert(ctx, makeRow(id, "sush", "sush@lala.com")); err != nil {
+					errs <- err
+				}
+			}
+		}(w)
+	}
+	done := make(chan struct{})
+	var readers sync.WaitGroup
+	for r := 0; r < 4; r++ {
+		readers.Add(1)
+		go func() {
+			defer readers.Done()
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				c := tab.Cursor(ctx)
+				for c.Next() {
+					if c.Row().Id == 0 {
+						errs <- errors.New("read a half written row")
+					}
+				}
+				if err := c.Err(); err != nil {
+					errs <- err
+				}
+				c.Close()
+			}
+		}()
+	}
+	wg.Wait()
+	close(done)
+	readers.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	seen := map[int64]bool{}
+	c := tab.Cursor(ctx)
+	defer c.Close()
+	for c.Next() {
+		seen[c.Row().Id] = true
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != numWriters*rowsPerWriter {
+		t.Fatalf("Expected %d distinct rows, got %d", numWriters*rowsPerWriter, len(seen))
+	}
+}
+
+func TestOneWriterAtATime(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	// a second writer waits until its context runs out
+	timeout, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := tab.Insert(timeout, makeRow(2, "sush", "sush@lala.com")); err != context.DeadlineExceeded {
+		t.Fatalf("Expected '%s', got '%v'", context.DeadlineExceeded, err)
+	}
+	// while readers go ahead
+	if n := countRows(t, tab.Cursor(ctx)); n != 0 {
+		t.Fatalf("Expected 0 committed rows, got %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTxReadsFromSnapshot(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := tab.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	reader, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := reader.Cursor(ctx)
+	defer c.Close()
+	if !c.Next() {
+		t.Fatal("reader did not see the first row")
+	}
+
+	// a long running reader does not hold up writers
+	for i := 2; i <= 20; i++ {
+		if err := tab.Insert(ctx, makeRow(int64(i), "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if c.Next() {
+		t.Fatalf("reader saw row '%+v' committed after it started", c.Row())
+	}
+	if n := countRows(t, reader.Cursor(ctx)); n != 1 {
+		t.Fatalf("Expected reader to keep seeing 1 row, got %d", n)
+	}
+	if err := reader.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 20 {
+		t.Fatalf("Expected 20 rows in a new snapshot, got %d", n)
+	}
+}
+
+func TestSecondWriterIsLockedOut(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		t.Skip("Tables of one process only lock each other out on linux")
+	}
+	first, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.CloseDb()
+	second, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.CloseDb()
+
+	ctx := context.Background()
+	tx, err := first.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := second.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != table.ErrDatabaseLocked {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrDatabaseLocked, err)
+	}
+	if n := countRows(t, second.Cursor(ctx)); n != 0 {
+		t.Fatalf("Expected 0 committed rows, got %d", n)
+	}
+
+	// with a busy timeout the second writer waits its turn
+	second.SetBusyTimeout(5 * time.Second)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		tx.Commit()
+	}()
+	if err := second.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, first.Cursor(ctx)); n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+}
+
+func TestDuplicateKey(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if err := tab.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Insert(ctx, makeRow(1, "other", "other@lala.com")); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrDuplicateKey, err)
+	}
+
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s' within a transaction, got '%v'", table.ErrDuplicateKey, err)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	// rolled back ids are free again
+	if err := tab.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+
+	// ids committed before the table was opened count too
+	if err := tab.CloseDb(); err != nil {
+		t.Fatal(err)
+	}
+	tab, err = table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Insert(ctx, makeRow(2, "sush", "sush@lala.com")); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s' after reopening, got '%v'", table.ErrDuplicateKey, err)
+	}
+}
+
+func TestIndexes(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := int64(1); i <= 40; i++ {
+		email := fmt.Sprintf("user%d@lala.com", i%10)
+		if err := tab.Insert(ctx, makeRow(i, "sush", email)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the same rows come back with and without an index
+	if n := countRows(t, tab.Lookup(ctx, "email", "user3@lala.com")); n != 4 {
+		t.Fatalf("Expected 4 rows without an index, got %d", n)
+	}
+	emailIdx := table.IndexDef{Name: "users_email_idx", Column: "email"}
+	if err := tab.CreateIndex(ctx, emailIdx); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.CreateIndex(ctx, emailIdx); err != table.ErrIndexExists {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrIndexExists, err)
+	}
+	c := tab.Lookup(ctx, "email", "user3@lala.com")
+	ids := []int64{}
+	for c.Next() {
+		ids = append(ids, c.Row().Id)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[3 13 23 33]" {
+		t.Fatalf("Expected ids [3 13 23 33] in insertion order, got %v", ids)
+	}
+
+	// the index is kept up to date, and sees the
+	// rows of the transaction it is used in
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(41, "sush", "user3@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tx.Lookup(ctx, "email", "user3@lala.com")); n != 5 {
+		t.Fatalf("Expected 5 rows within the transaction, got %d", n)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a unique index can't be built over duplicates
+	unique := table.IndexDef{Name: "users_email_key", Column: "email", Unique: true}
+	if err := tab.CreateIndex(ctx, unique); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrDuplicateKey, err)
+	}
+	unique = table.IndexDef{Name: "users_username_key", Column: "username", Unique: true}
+	if err := tab.CreateIndex(ctx, unique); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrDuplicateKey, err)
+	}
+
+	// indexes are kept in the file
+	if err := tab.CloseDb(); err != nil {
+		t.Fatal(err)
+	}
+	tab, err = table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defs, err := tab.Indexes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || defs[0] != emailIdx {
+		t.Fatalf("Expected only %v after reopening, got %v", emailIdx, defs)
+	}
+	if n := countRows(t, tab.Lookup(ctx, "email", "user3@lala.com")); n != 5 {
+		t.Fatalf("Expected 5 rows after reopening, got %d", n)
+	}
+
+	if err := tab.DropIndex(ctx, "users_email_idx"); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.DropIndex(ctx, "users_email_idx"); err != table.ErrNoSuchIndex {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrNoSuchIndex, err)
+	}
+	if defs, _ := tab.Indexes(); len(defs) != 0 {
+		t.Fatalf("Expected no indexes, got %v", defs)
+	}
+}
+
+func TestUniqueIndex(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	unique := table.IndexDef{Name: "users_email_key", Column: "email", Unique: true}
+	if err := tab.CreateIndex(ctx, unique); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Insert(ctx, makeRow(1, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Insert(ctx, makeRow(2, "other", "sush@lala.com")); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrDuplicateKey, err)
+	}
+
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(2, "other", "other@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(3, "third", "other@lala.com")); err != table.ErrDuplicateKey {
+		t.Fatalf("Expected '%s' within a transaction, got '%v'", table.ErrDuplicateKey, err)
+	}
+	if err := tx.Commit(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+	if err := tab.Lookup(ctx, "email", int64(1)).Err(); err != table.ErrTypeMismatch {
+		t.Fatalf("Expected '%s', got '%v'", table.ErrTypeMismatch, err)
+	}
+}
+
+func TestGetByIDAndScan(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	// insert ids out of order: 0, 7, 14, ... 350, 6, 13, ...
+	for i := int64(0); i < 351; i++ {
+		id := (i * 7) % 351
+		if err := tab.Insert(ctx, makeRow(id, "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r, ok, err := tab.GetByID(123)
+	if err != nil || !ok || r.Id != 123 {
+		t.Fatalf("Expected row 123, got %v %v %v", r.Id, ok, err)
+	}
+	if _, ok, err := tab.GetByID(351); err != nil || ok {
+		t.Fatalf("Expected no row 351, got %v %v", ok, err)
+	}
+
+	tx, err := tab.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(1000, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tx.Insert(ctx, makeRow(-5, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok, _ := tx.GetByID(1000); !ok {
+		t.Fatalf("Expected the transaction to see its own row")
+	}
+
+	// committed and pending rows come back merged in id order
+	c := tx.Scan(ctx, -10, 5)
+	ids := []int64{}
+	for c.Next() {
+		ids = append(ids, c.Row().Id)
+	}
+	if err := c.Err(); err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(ids) != "[-5 0 1 2 3 4 5]" {
+		t.Fatalf("Expected ids [-5 0 1 2 3 4 5], got %v", ids)
+	}
+	if err := tx.Rollback(); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Scan(ctx, 100, 199)); n != 100 {
+		t.Fatalf("Expected 100 rows, got %d", n)
+	}
+	if n := countRows(t, tab.Scan(ctx, 10, 5)); n != 0 {
+		t.Fatalf("Expected no rows in an empty range, got %d", n)
+	}
+
+	// a point lookup reads only the page that holds the row,
+	// where a full scan reads all 27 pages
+	c = tab.Lookup(ctx, "id", int64(200))
+	if n := countRows(t, c); n != 1 || c.PagesRead() != 1 {
+		t.Fatalf("Expected 1 row off 1 page, got %d rows off %d pages", n, c.PagesRead())
+	}
+	c = tab.Cursor(ctx)
+	if n := countRows(t, c); n != 351 || c.PagesRead() != 27 {
+		t.Fatalf("Expected 351 rows off 27 pages, got %d rows off %d pages", n, c.PagesRead())
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	if stats, err := tab.Stats(); err != nil || stats != nil {
+		t.Fatalf("Expected no stats before analyze, got %v %v", stats, err)
+	}
+	for i := int64(1); i <= 100; i++ {
+		email := fmt.Sprintf("user%d@lala.com", i%2)
+		if err := tab.Insert(ctx, makeRow(i, "sush", email)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tab.Analyze(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// stats are kept in the file
+	if err := tab.CloseDb(); err != nil {
+		t.Fatal(err)
+	}
+	tab, err = table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	stats, err := tab.Stats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats == nil || stats.NumRows != 100 || stats.Pages() != 8 {
+		t.Fatalf("Expected stats of 100 rows on 8 pages, got %v", stats)
+	}
+	distinct := map[string]uint{}
+	for _, c := range stats.Columns {
+		distinct[c.Column] = c.Distinct
+	}
+	if distinct["id"] != 100 || distinct["username"] != 1 || distinct["email"] != 2 {
+		t.Fatalf("Expected 100, 1 and 2 distinct values, got %v", distinct)
+	}
+
+	if est := stats.Estimate("id", int64(7), int64(7)); est != 1 {
+		t.Fatalf("Expected 1 row with an id, got %v", est)
+	}
+	if est := stats.Estimate("email", "user1@lala.com", "user1@lala.com"); est != 50 {
+		t.Fatalf("Expected 50 rows with an email, got %v", est)
+	}
+	if est := stats.Estimate("id", int64(1), int64(50)); est < 25 || est > 75 {
+		t.Fatalf("Expected about 50 rows in half of the ids, got %v", est)
+	}
+	if est := stats.Estimate("id", int64(200), int64(300)); est != 0 {
+		t.Fatalf("Expected no rows past the last id, got %v", est)
+	}
+}
+
+func TestPagesAndBTree(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := int64(1); i <= 20; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	pages, err := tab.Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 13 rows fit in a page
+	if len(pages) != 3 || pages[0].Free != 0 || pages[1].Type != "data" || pages[2].Type != "meta" {
+		t.Fatalf("Expected a full data page, a partial one and the meta page, got %v", pages)
+	}
+	if fill := pages[1].Fill(); fill != 7.0/13 {
+		t.Fatalf("Expected the second page to be 7/13 full, got %v", fill)
+	}
+	if _, err := tab.Page(2); err != table.ErrNoSuchPage {
+		t.Fatalf("Expected %v past the last row, got %v", table.ErrNoSuchPage, err)
+	}
+	meta, err := tab.Page(table.MetaPage)
+	if err != nil || string(meta[:8]) != "simpledb" {
+		t.Fatalf("Expected the meta page, got %q %v", meta[:16], err)
+	}
+
+	nodes, err := tab.BTree(table.PrimaryKey.Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 20 entries overflow a single node
+	if len(nodes) != 3 || nodes[0].Leaf || len(nodes[0].Children) != 2 || !nodes[1].Leaf {
+		t.Fatalf("Expected a root with two leaves, got %v", nodes)
+	}
+	entries := 0
+	for _, n := range nodes {
+		entries += len(n.Keys)
+	}
+	if entries != 20 || nodes[1].Keys[0] != int64(1) || nodes[1].Rows[0] != 0 {
+		t.Fatalf("Expected 20 entries starting with id 1 at row 0, got %v", nodes)
+	}
+	if _, err := tab.BTree("nope"); err != table.ErrNoSuchIndex {
+		t.Fatalf("Expected %v, got %v", table.ErrNoSuchIndex, err)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := int64(1); i <= 3; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "sush", "sush@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if problems, err := tab.Check(); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v %v", problems, err)
+	}
+
+	// damage the file behind the table's back: give the second
+	// row the id of the first, and put junk after the email of
+	// the third
+	f, err := os.OpenFile("temp.db", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rowSize = 8 + 32 + 256
+	if _, err := f.WriteAt([]byte{1}, rowSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("junk"), 3*rowSize-4); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	problems, err := tab.Check()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"page 0: checksum is 2ee178e1, expected af3dfb61",
+		"row 2: email has bytes after its end",
+		"index users_pkey: entry 1 is 2@1, expected 1@1",
+		"index users_pkey: rows 0 and 1 have the same key 1",
+	}
+	if fmt.Sprint(problems) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, problems)
+	}
+
+	// a meta page that doesn't match its
+	// checksum can't be trusted at all
+	f, err = os.OpenFile("temp.db", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const metaOffset = 100 * 4096
+	if _, err := f.WriteAt([]byte{2}, metaOffset+16); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := tab.Check(); err == nil {
+		t.Fatal("Expected a damaged meta page to be refused")
+	}
+	if _, err := table.OpenDb("temp.db"); err == nil {
+		t.Fatal("Expected a database with a damaged meta page not to open")
+	}
+}
+
+func TestBackupAndRestore(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+		os.Remove("backup.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// other stands in for another process
+	// that has the database open
+	other, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := int64(1); i <= 20; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "sush", fmt.Sprintf("user%d@lala.com", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	def := table.IndexDef{Name: "by_email", Column: "email", Unique: true}
+	if err := tab.CreateIndex(ctx, def); err != nil {
+		t.Fatal(err)
+	}
+	if err := tab.Backup(ctx, "backup.db"); err != nil {
+		t.Fatal(err)
+	}
+	// a backup over the database would leave
+	// it writing to a file that is gone
+	if err := tab.Backup(ctx, "./temp.db"); err != table.ErrBackupOntoItself {
+		t.Fatalf("Expected the database not to be backed up onto itself, got %v", err)
+	}
+
+	// change the database after the backup: the
+	// index gone, and more rows
+	if err := tab.DropIndex(ctx, def.Name); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(21); i <= 30; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "lala", "lala@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := countRows(t, other.Cursor(ctx)); n != 30 {
+		t.Fatalf("Expected 30 rows before the restore, got %d", n)
+	}
+
+	// files that aren't sound backups are refused,
+	// leaving the database as it was
+	bad := []func() []byte{
+		func() []byte {
+			junk := make([]byte, 2000)
+			rand.Read(junk)
+			return junk
+		},
+		func() []byte {
+			junk := make([]byte, 600*1024)
+			rand.Read(junk)
+			return junk
+		},
+		func() []byte {
+			// a negative id in the first row
+			b, err := os.ReadFile("backup.db")
+			if err != nil {
+				t.Fatal(err)
+			}
+			b[7] = 0x80
+			return b
+		},
+	}
+	for i, contents := range bad {
+		if err := os.WriteFile("bad.db", contents(), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if err := tab.Restore(ctx, "bad.db"); err != table.ErrBadBackup {
+			t.Fatalf("Expected bad backup %d to be refused, got %v", i, err)
+		}
+		if n := countRows(t, other.Cursor(ctx)); n != 30 {
+			t.Fatalf("Expected the 30 rows to stay after bad backup %d, got %d", i, n)
+		}
+	}
+	os.Remove("bad.db")
+
+	// cursors left open across the restore, in this
+	// process and in the other one
+	var open []*table.Cursor
+	for _, db := range []*table.Table{tab, other} {
+		c := db.Cursor(ctx)
+		defer c.Close()
+		if !c.Next() {
+			t.Fatalf("Expected a row before the restore, got %v", c.Err())
+		}
+		open = append(open, c)
+	}
+	if err := tab.Restore(ctx, "backup.db"); err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []*table.Table{tab, other} {
+		if n := countRows(t, db.Cursor(ctx)); n != 20 {
+			t.Fatalf("Expected the 20 rows of the backup, got %d", n)
+		}
+		indexes, err := db.Indexes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(indexes) != 1 || indexes[0] != def {
+			t.Fatalf("Expected the index of the backup, got %v", indexes)
+		}
+		r, ok, err := db.GetByID(20)
+		if err != nil || !ok || r.Id != 20 {
+			t.Fatalf("Expected to find the last row of the backup, got %v %v %v", r, ok, err)
+		}
+		if _, ok, _ := db.GetByID(21); ok {
+			t.Fatal("Expected the rows inserted after the backup to be gone")
+		}
+		if problems, err := db.Check(); err != nil || len(problems) != 0 {
+			t.Fatalf("Expected no problems after the restore, got %v %v", problems, err)
+		}
+	}
+	// the other process sees the restore once it
+	// catches up, as it did above
+	for i, c := range open {
+		if c.Next() || c.Err() != table.ErrRestored {
+			t.Fatalf("Expected cursor %d to fail with %v after the restore, got %v", i, table.ErrRestored, c.Err())
+		}
+	}
+
+	// the restored database takes new rows as usual
+	if err := other.Insert(ctx, makeRow(21, "lala", "lala@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	if n := countRows(t, tab.Cursor(ctx)); n != 21 {
+		t.Fatalf("Expected 21 rows, got %d", n)
+	}
+	other.CloseDb()
+}
+
+func TestSalvage(t *testing.T) {
+	tab, err := table.OpenDb("temp.db")
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := context.Background()
+	for i := int64(1); i <= 20; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "sush", fmt.Sprintf("user%d@lala.com", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	def := table.IndexDef{Name: "by_email", Column: "email", Unique: true}
+	if err := tab.CreateIndex(ctx, def); err != nil {
+		t.Fatal(err)
+	}
+	tab.CloseDb()
+
+	// give the second row the id of the first,
+	// and put junk after the username of the third
+	f, err := os.OpenFile("temp.db", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const rowSize = 8 + 32 + 256
+	if _, err := f.WriteAt([]byte{1}, rowSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt([]byte("junk"), 2*rowSize+8+28); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := table.Salvage("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		"page 0: skipped row 1, its id 1 is that of row 0",
+		"page 0: skipped row 2, its username has bytes after its end",
+	}
+	if fmt.Sprint(s.Problems) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, s.Problems)
+	}
+	if len(s.Rows) != 18 || s.Rows[1].Id != 4 {
+		t.Fatalf("Expected 18 rows without the second and third, got %v", s.Rows)
+	}
+	if len(s.Indexes) != 1 || s.Indexes[0] != def {
+		t.Fatalf("Expected the index to be kept, got %v", s.Indexes)
+	}
+
+	// cut the file short in the middle of a row,
+	// which takes the meta page with it
+	if err := f.Truncate(15*rowSize + 100); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	s, err = table.Salvage("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"meta page: missing, scanning every page",
+		"page 0: skipped row 1, its id 1 is that of row 0",
+		"page 0: skipped row 2, its username has bytes after its end",
+		"page 1: truncated, 1 of its 3 rows are missing",
+	}
+	if fmt.Sprint(s.Problems) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, s.Problems)
+	}
+	if len(s.Rows) != 13 || len(s.Indexes) != 0 {
+		t.Fatalf("Expected 13 rows and no indexes, got %d rows and %v", len(s.Rows), s.Indexes)
+	}
+
+	// fill every row up to the meta page, which
+	// is more than the table can hold
+	f, err = os.OpenFile("temp.db", os.O_RDWR|os.O_TRUNC, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const numRows = 100 * 4096 / rowSize
+	buf := make([]byte, numRows*rowSize)
+	for i := 0; i < numRows; i++ {
+		binary.LittleEndian.PutUint64(buf[i*rowSize:], uint64(i+1))
+	}
+	if _, err := f.Write(buf); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	s, err = table.Salvage("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = []string{
+		"meta page: missing, scanning every page",
+		"past row 1299: skipped, the table holds at most 1300 rows",
+	}
+	if fmt.Sprint(s.Problems) != fmt.Sprint(want) {
+		t.Fatalf("Expected %q, got %q", want, s.Problems)
+	}
+	if len(s.Rows) != 1300 {
+		t.Fatalf("Expected 1300 rows, got %d", len(s.Rows))
+	}
+}
+
+func TestRestoreCutShort(t *testing.T) {
+	defer func() {
+		os.Remove("temp.db")
+		os.Remove("backup.db")
+	}()
+	ctx := context.Background()
+	tab, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(1); i <= 20; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "sush", fmt.Sprintf("user%d@lala.com", i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tab.Backup(ctx, "backup.db"); err != nil {
+		t.Fatal(err)
+	}
+	for i := int64(21); i <= 30; i++ {
+		if err := tab.Insert(ctx, makeRow(i, "lala", "lala@lala.com")); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// stage the backup the way Restore does, and
+	// crash halfway through copying it into place
+	backup, err := os.ReadFile("backup.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const (
+		rowSize    = 8 + 32 + 256
+		pageSize   = 4096
+		metaOffset = 100 * pageSize
+	)
+	f, err := os.OpenFile("temp.db", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(backup[:20*rowSize], metaOffset+2*pageSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(backup[metaOffset:metaOffset+pageSize], metaOffset+pageSize); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := f.WriteAt(make([]byte, 5*rowSize), 0); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	// the rows are half replaced, so
+	// they can't be read in the meantime
+	if _, err := tab.Stats(); err != table.ErrDatabaseLocked {
+		t.Fatalf("Expected '%s' while the restore is unfinished, got %v", table.ErrDatabaseLocked, err)
+	}
+	reopened, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, db := range []*table.Table{reopened, tab} {
+		if n := countRows(t, db.Cursor(ctx)); n != 20 {
+			t.Fatalf("Expected the 20 rows of the backup, got %d", n)
+		}
+		if problems, err := db.Check(); err != nil || len(problems) != 0 {
+			t.Fatalf("Expected no problems after finishing the restore, got %v %v", problems, err)
+		}
+	}
+	fileInfo, err := os.Stat("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fileInfo.Size() != metaOffset+pageSize {
+		t.Fatalf("Expected the staged rows to be cut off, the file is %d bytes", fileInfo.Size())
+	}
+	reopened.CloseDb()
+	tab.CloseDb()
+}
+
+func TestMetaWithoutChecksums(t *testing.T) {
+	defer func() {
+		os.Remove("temp.db")
+	}()
+	// a file written before pages had checksums:
+	// two rows and a meta page with no catalog
+	const (
+		rowSize    = 8 + 32 + 256
+		metaOffset = 100 * 4096
+	)
+	b := make([]byte, metaOffset+4096)
+	for i := 0; i < 2; i++ {
+		binary.LittleEndian.PutUint64(b[i*rowSize:], uint64(i+1))
+		copy(b[i*rowSize+8:], "sush")
+	}
+	copy(b[metaOffset:], "simpledb meta 1\x00")
+	binary.LittleEndian.PutUint64(b[metaOffset+16:], 2)
+	if err := os.WriteFile("temp.db", b, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	tab, err := table.OpenDb("temp.db")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tab.CloseDb()
+	if n := countRows(t, tab.Cursor(ctx)); n != 2 {
+		t.Fatalf("Expected 2 rows, got %d", n)
+	}
+	if problems, err := tab.Check(); err != nil || len(problems) != 0 {
+		t.Fatalf("Expected no problems, got %v %v", problems, err)
+	}
+
+	// the next commit adds the checksums, of the
+	// rows that were there as well
+	if err := tab.Insert(ctx, makeRow(3, "sush", "sush@lala.com")); err != nil {
+		t.Fatal(err)
+	}
+	f, err := os.OpenFile("temp.db", os.O_RDWR, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	magic := make([]byte, 16)
+	if _, err := f.ReadAt(magic, metaOffset); err != nil || string(magic) != "simpledb meta 2\x00" {
+		t.Fatalf("Expected the meta page to have checksums, got %q %v", magic, err)
+	}
+	if _, err := f.WriteAt([]byte("x"), 8); err != nil {
+		t.Fatal(err)
+	}
+	problems, err := tab.Check()
+	if err != nil || len(problems) != 1 || !strings.HasPrefix(problems[0], "page 0: checksum is") {
+		t.Fatalf("Expected the first page not to match its checksum, got %v %v", problems, err)
+	}
+}
@@ -0,0 +1,297 @@
+package table
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	ErrTxDone      = errors.New("transaction has already been committed or rolled back")
+	ErrNoSavepoint = errors.New("no such savepoint")
+)
+
+// Tx is a transaction on the Table. Rows inserted
+// through a Tx are kept aside until Commit, so other
+// readers don't see them and Rollback can simply
+// forget about them
+//
+// A Tx reads from the snapshot of the table taken
+// when it began: rows committed by other transactions
+// after that are not visible to it
+//
+// This is not multi-version concurrency control. There
+// are no row versions, transaction ids or visibility
+// rules, and nothing to garbage collect. Rows are only
+// ever appended, so a snapshot is just the number of
+// committed rows and the indexes over them. Updates or
+// deletes would need real row versions
+//
+// A Tx must only be used by one goroutine at a time.
+// The first Insert waits for any other transaction
+// that is writing to finish
+type Tx struct {
+	t *Table
+	// writing is true once the transaction
+	// holds the table's writer lock
+	writing bool
+	// snapshot holds the committed rows that
+	// are visible to the transaction
+	snapshot snapshot
+	// rows inserted by this transaction,
+	// in insertion order
+	pending []Row
+	// pendingKeys holds the keys of pending
+	// in each unique index, by index name
+	pendingKeys map[string]map[string]bool
+	// savepoints that are currently active,
+	// oldest first
+	savepoints []savepoint
+	done       bool
+}
+
+// savepoint marks how many rows the transaction
+// had pending when the savepoint was set
+type savepoint struct {
+	name       string
+	numPending int
+}
+
+// Begin starts a transaction
+func (t *Table) Begin() (*Tx, error) {
+	snapshot, err := t.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return &Tx{
+		t:           t,
+		snapshot:    snapshot,
+		pendingKeys: map[string]map[string]bool{},
+	}, nil
+}
+
+// Insert adds r to the transaction. It fails with
+// ErrDuplicateKey if a row with the same id, or the
+// same value in a column with a unique index, was
+// committed or inserted earlier in the transaction
+func (tx *Tx) Insert(ctx context.Context, r Row) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if !tx.writing {
+		if err := tx.t.lockWriter(ctx); err != nil {
+			return err
+		}
+		tx.writing = true
+	}
+	if tx.t.numRows()+uint(len(tx.pending)) >= maxNumRows {
+		return ErrTableFull
+	}
+	// the writer lock guarantees that no other commit
+	// can sneak in a row with the same key
+	indexes := tx.t.current().indexes
+	for _, idx := range indexes {
+		if !idx.def.Unique {
+			continue
+		}
+		key, err := r.columnKey(idx.def.Column)
+		if err != nil {
+			return err
+		}
+		if tx.pendingKeys[idx.def.Name][key] || idx.tree.has(key) {
+			return ErrDuplicateKey
+		}
+	}
+	tx.pending = append(tx.pending, r)
+	tx.addPendingKeys(indexes, r)
+	return nil
+}
+
+// addPendingKeys adds the keys of r in
+// the unique indexes to pendingKeys
+func (tx *Tx) addPendingKeys(indexes []*index, r Row) {
+	for _, idx := range indexes {
+		if !idx.def.Unique {
+			continue
+		}
+		key, _ := r.columnKey(idx.def.Column)
+		keys := tx.pendingKeys[idx.def.Name]
+		if keys == nil {
+			keys = map[string]bool{}
+			tx.pendingKeys[idx.def.Name] = keys
+		}
+		keys[key] = true
+	}
+}
+
+// Cursor returns a cursor over the committed rows of
+// the table followed by the rows inserted so far in
+// this transaction
+func (tx *Tx) Cursor(ctx context.Context) *Cursor {
+	return &Cursor{
+		ctx:      ctx,
+		t:        tx.t,
+		end:      tx.snapshot.numRows,
+		indexes:  tx.snapshot.indexes,
+		restores: tx.snapshot.restores,
+		pending:  tx.pending,
+	}
+}
+
+// Commit appends the rows of the transaction to the
+// table and writes them to disk. Either all of the
+// rows are committed or none of them are
+func (tx *Tx) Commit() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	if !tx.writing {
+		// read only transaction
+		return nil
+	}
+	defer tx.t.unlockWriter()
+
+	// Only the writer moves nextFreeRow, and no reader
+	// looks past the snapshot it took, so the new rows
+	// can be written and flushed without blocking readers.
+	// They become visible all at once below
+	t := tx.t
+	from := t.numRows()
+	to := from + uint(len(tx.pending))
+	if to > maxNumRows {
+		return ErrTableFull
+	}
+	rows := tx.pending
+	for i, r := range rows {
+		if err := t.writeRow(from+uint(i), r); err != nil {
+			return err
+		}
+	}
+	tx.pending = nil
+	tx.pendingKeys = nil
+	t.mu.RLock()
+	catalog := t.catalog
+	indexes, err := addRows(t.indexes, rows, from)
+	t.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+
+	// keep readers of other processes from seeing
+	// the rows before they are all on disk
+	if err := t.lock.lockCommit(); err != nil {
+		return err
+	}
+	defer t.lock.unlockCommit()
+	if err := t.p.flushRows(from, to); err != nil {
+		return err
+	}
+	if err := t.p.f.Sync(); err != nil {
+		return err
+	}
+	// the rows only count once the meta page says so,
+	// which makes a commit cut short harmless
+	if err := t.p.writeMeta(to, catalog); err != nil {
+		return err
+	}
+	if err := t.p.f.Sync(); err != nil {
+		return err
+	}
+	t.p.committed(to)
+	t.mu.Lock()
+	t.nextFreeRow = to
+	t.indexes = indexes
+	t.numIndexed = to
+	t.mu.Unlock()
+	return nil
+}
+
+// Rollback throws away the rows of the transaction
+func (tx *Tx) Rollback() error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.done = true
+	tx.undo(0)
+	tx.savepoints = nil
+	if tx.writing {
+		tx.t.unlockWriter()
+	}
+	return nil
+}
+
+// Savepoint marks the current state of the transaction
+// under name, so that it can later be returned to with
+// RollbackTo. Savepoints with the same name may nest,
+// the most recent one wins
+func (tx *Tx) Savepoint(name string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	tx.savepoints = append(tx.savepoints, savepoint{
+		name:       name,
+		numPending: len(tx.pending),
+	})
+	return nil
+}
+
+// Release forgets the savepoint name and every savepoint
+// set after it. The rows inserted since stay part of
+// the transaction
+func (tx *Tx) Release(name string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	i := tx.findSavepoint(name)
+	if i < 0 {
+		return ErrNoSavepoint
+	}
+	tx.savepoints = tx.savepoints[:i]
+	return nil
+}
+
+// RollbackTo throws away the rows inserted since the
+// savepoint name was set, along with every savepoint
+// set after it. The savepoint itself stays active
+func (tx *Tx) RollbackTo(name string) error {
+	if tx.done {
+		return ErrTxDone
+	}
+	i := tx.findSavepoint(name)
+	if i < 0 {
+		return ErrNoSavepoint
+	}
+	tx.undo(tx.savepoints[i].numPending)
+	tx.savepoints = tx.savepoints[:i+1]
+	return nil
+}
+
+// findSavepoint returns the position of the most recent
+// savepoint called name, or -1 if there is none
+func (tx *Tx) findSavepoint(name string) int {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i].name == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// undo throws away every pending row past
+// the first numPending ones
+func (tx *Tx) undo(numPending int) {
+	// copy rather than reslice: cursors opened earlier
+	// in the transaction still hold the old slice, and
+	// later inserts must not overwrite what they see
+	kept := make([]Row, numPending)
+	copy(kept, tx.pending)
+	tx.pending = kept
+	tx.pendingKeys = map[string]map[string]bool{}
+	indexes := tx.t.current().indexes
+	for _, r := range kept {
+		tx.addPendingKeys(indexes, r)
+	}
+}